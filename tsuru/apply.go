@@ -0,0 +1,593 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/yaml.v1"
+	"launchpad.net/gnuflag"
+)
+
+// appManifest describes the desired state of an app, as read by tsuru
+// apply. Lists and values left out of the manifest are not managed by it.
+type appManifest struct {
+	Name      string             `json:"name" yaml:"name"`
+	Platform  string             `json:"platform,omitempty" yaml:"platform,omitempty"`
+	Plan      string             `json:"plan,omitempty" yaml:"plan,omitempty"`
+	TeamOwner string             `json:"team-owner,omitempty" yaml:"team-owner,omitempty"`
+	Teams     []string           `json:"teams,omitempty" yaml:"teams,omitempty"`
+	CNames    []string           `json:"cnames,omitempty" yaml:"cnames,omitempty"`
+	Env       map[string]string  `json:"env,omitempty" yaml:"env,omitempty"`
+	Units     *int               `json:"units,omitempty" yaml:"units,omitempty"`
+	Services  []string           `json:"services,omitempty" yaml:"services,omitempty"`
+	AutoScale *manifestAutoScale `json:"autoscale,omitempty" yaml:"autoscale,omitempty"`
+}
+
+type manifestAutoScale struct {
+	Enabled  bool                `json:"enabled" yaml:"enabled"`
+	MinUnits int                 `json:"min-units" yaml:"min-units"`
+	MaxUnits int                 `json:"max-units" yaml:"max-units"`
+	Increase manifestScaleAction `json:"increase" yaml:"increase"`
+	Decrease manifestScaleAction `json:"decrease" yaml:"decrease"`
+}
+
+type manifestScaleAction struct {
+	Step       int    `json:"step" yaml:"step"`
+	Wait       int    `json:"wait" yaml:"wait"`
+	Expression string `json:"expression" yaml:"expression"`
+}
+
+// flags returns the flags of autoscale-config that apply the configuration.
+// Every field is given, so the defaults of autoscale-config never replace
+// the values of the manifest, zero values included.
+func (a *manifestAutoScale) flags() []string {
+	flags := []string{
+		"--min-units", strconv.Itoa(a.MinUnits),
+		"--max-units", strconv.Itoa(a.MaxUnits),
+		"--increase-step", strconv.Itoa(a.Increase.Step),
+		"--increase-wait-time", strconv.Itoa(a.Increase.Wait),
+		"--increase-expression", a.Increase.Expression,
+		"--decrease-step", strconv.Itoa(a.Decrease.Step),
+		"--decrease-wait-time", strconv.Itoa(a.Decrease.Wait),
+		"--decrease-expression", a.Decrease.Expression,
+	}
+	if a.Enabled {
+		flags = append(flags, "--enabled")
+	}
+	return flags
+}
+
+func readManifest(path string) (*appManifest, error) {
+	f, err := filesystem().Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	var manifest appManifest
+	err = yaml.Unmarshal(data, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %s", path, err)
+	}
+	if manifest.Name == "" {
+		return nil, fmt.Errorf("invalid manifest %s: the name of the app is required", path)
+	}
+	if manifest.Units != nil && *manifest.Units < 0 {
+		return nil, fmt.Errorf("invalid manifest %s: the number of units can't be negative", path)
+	}
+	return &manifest, nil
+}
+
+// liveApp is the current state of an app, compared with the manifest.
+type liveApp struct {
+	app *app
+	// env holds the public environment variables of the app.
+	env map[string]string
+	// privateEnv holds the names of the private environment variables.
+	privateEnv map[string]bool
+	// services holds the names of the service instances bound to the app.
+	services []string
+	// autoScale is the autoscale configuration of the app, only loaded
+	// when the manifest has one.
+	autoScale *manifestAutoScale
+}
+
+// getLiveApp loads the state of the app using the same endpoints as app-info,
+// env-get and service-list. It returns nil when the app doesn't exist.
+func getLiveApp(client *cmd.Client, appName string) (*liveApp, error) {
+	a, err := getApp(client, appName)
+	if err != nil {
+		if httpErr, ok := err.(*tsuruErrors.HTTP); ok && httpErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	live := liveApp{app: a, env: map[string]string{}, privateEnv: map[string]bool{}}
+	var g cmd.GuessingCommand
+	g.Flags().Parse(true, []string{"-a", appName})
+	b, err := requestEnvURL("GET", g, nil, client)
+	if err != nil {
+		return nil, err
+	}
+	var variables []struct {
+		Name   string
+		Value  string
+		Public bool
+	}
+	err = json.Unmarshal(b, &variables)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range variables {
+		if v.Public {
+			live.env[v.Name] = v.Value
+		} else {
+			live.privateEnv[v.Name] = true
+		}
+	}
+	services, err := appServiceInstances(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		live.services = append(live.services, service.Instances...)
+	}
+	return &live, nil
+}
+
+// appServiceInstances returns the service instances bound to the app,
+// grouped by service.
+func appServiceInstances(client *cmd.Client, appName string) ([]serviceData, error) {
+	body, _, err := apiGet(client, fmt.Sprintf("/services/instances?app=%s", appName))
+	if err != nil {
+		return nil, err
+	}
+	var services []serviceData
+	if len(body) > 0 {
+		err = json.Unmarshal(body, &services)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return services, nil
+}
+
+// getAutoScale loads the autoscale configuration of the app, returning nil
+// when the tsuru server doesn't support autoscale.
+func getAutoScale(client *cmd.Client, appName string) (*manifestAutoScale, error) {
+	body, _, err := apiGet(client, fmt.Sprintf("/autoscale/%s", appName))
+	if err != nil {
+		if httpErr, ok := err.(*tsuruErrors.HTTP); ok && httpErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+	var config AutoScaleConfig
+	err = json.Unmarshal(body, &config)
+	if err != nil {
+		return nil, err
+	}
+	return &manifestAutoScale{
+		Enabled:  config.Enabled,
+		MinUnits: config.MinUnits,
+		MaxUnits: config.MaxUnits,
+		Increase: manifestScaleAction{
+			Step:       config.Increase.Units,
+			Wait:       int(time.Duration(config.Increase.Wait) / time.Second),
+			Expression: config.Increase.Expression,
+		},
+		Decrease: manifestScaleAction{
+			Step:       config.Decrease.Units,
+			Wait:       int(time.Duration(config.Decrease.Wait) / time.Second),
+			Expression: config.Decrease.Expression,
+		},
+	}, nil
+}
+
+// manifestChange is a change needed to bring the app to the state described
+// by the manifest. Changes without an apply function can't be made by tsuru
+// apply and are only displayed in the plan.
+type manifestChange struct {
+	// kind is + for additions, - for removals and ~ for updates.
+	kind        string
+	description string
+	apply       func(context *cmd.Context, client *cmd.Client) error
+}
+
+func (c manifestChange) String() string {
+	if c.apply == nil {
+		return "! " + c.description
+	}
+	return c.kind + " " + c.description
+}
+
+// planManifest computes the changes needed to bring live to the state
+// described by the manifest. A nil live app is created.
+func planManifest(m *appManifest, live *liveApp) []manifestChange {
+	var changes []manifestChange
+	if live == nil {
+		if m.Platform == "" {
+			return []manifestChange{{
+				description: fmt.Sprintf("app %s doesn't exist and the manifest has no platform to create it", m.Name),
+			}}
+		}
+		changes = append(changes, createChange(m))
+		live = &liveApp{app: &app{Name: m.Name, TeamOwner: m.TeamOwner}}
+		if m.TeamOwner != "" {
+			live.app.Teams = []string{m.TeamOwner}
+		}
+	}
+	a := live.app
+	if m.Platform != "" && m.Platform != a.Platform && a.Platform != "" {
+		changes = append(changes, manifestChange{
+			description: fmt.Sprintf("platform can't be changed from %s to %s by apply", a.Platform, m.Platform),
+		})
+	}
+	if m.Plan != "" && m.Plan != a.Plan.Name && a.Plan.Name != "" {
+		changes = append(changes, manifestChange{
+			description: fmt.Sprintf("plan can't be changed from %s to %s by apply", a.Plan.Name, m.Plan),
+		})
+	}
+	if m.TeamOwner != "" && m.TeamOwner != a.TeamOwner {
+		changes = append(changes, manifestChange{
+			kind:        "~",
+			description: fmt.Sprintf("change the team owner from %s to %s", a.TeamOwner, m.TeamOwner),
+			apply:       appCommandChange(&SetTeamOwner{}, m.Name, []string{m.TeamOwner}),
+		})
+	}
+	if m.Teams != nil {
+		added, removed := diffStrings(a.Teams, m.Teams)
+		for _, team := range added {
+			changes = append(changes, manifestChange{
+				kind:        "+",
+				description: fmt.Sprintf("grant access to team %s", team),
+				apply:       appCommandChange(&appGrant{}, m.Name, []string{team}),
+			})
+		}
+		for _, team := range removed {
+			changes = append(changes, manifestChange{
+				kind:        "-",
+				description: fmt.Sprintf("revoke access from team %s", team),
+				apply:       appCommandChange(&appRevoke{}, m.Name, []string{team}),
+			})
+		}
+	}
+	if m.CNames != nil {
+		added, removed := diffStrings(a.CName, m.CNames)
+		if len(added) > 0 {
+			changes = append(changes, manifestChange{
+				kind:        "+",
+				description: fmt.Sprintf("add cname %s", strings.Join(added, ", ")),
+				apply:       appCommandChange(&cnameAdd{}, m.Name, added),
+			})
+		}
+		if len(removed) > 0 {
+			changes = append(changes, manifestChange{
+				kind:        "-",
+				description: fmt.Sprintf("remove cname %s", strings.Join(removed, ", ")),
+				apply:       appCommandChange(&cnameRemove{}, m.Name, removed),
+			})
+		}
+	}
+	changes = append(changes, planEnv(m, live)...)
+	if m.Services != nil {
+		added, removed := diffStrings(live.services, m.Services)
+		for _, instance := range added {
+			changes = append(changes, manifestChange{
+				kind:        "+",
+				description: fmt.Sprintf("bind service instance %s", instance),
+				apply:       appCommandChange(&serviceBind{}, m.Name, []string{instance}),
+			})
+		}
+		for _, instance := range removed {
+			changes = append(changes, manifestChange{
+				kind:        "-",
+				description: fmt.Sprintf("unbind service instance %s", instance),
+				apply:       appCommandChange(&serviceUnbind{}, m.Name, []string{instance}),
+			})
+		}
+	}
+	if m.Units != nil {
+		current := a.unitCount()
+		switch delta := *m.Units - current; {
+		case delta > 0:
+			changes = append(changes, manifestChange{
+				kind:        "+",
+				description: fmt.Sprintf("add %d units (%d -> %d)", delta, current, *m.Units),
+				apply:       appCommandChange(&unitAdd{}, m.Name, []string{strconv.Itoa(delta)}),
+			})
+		case delta < 0:
+			changes = append(changes, manifestChange{
+				kind:        "-",
+				description: fmt.Sprintf("remove %d units (%d -> %d)", -delta, current, *m.Units),
+				apply:       appCommandChange(&unitRemove{}, m.Name, []string{strconv.Itoa(-delta)}),
+			})
+		}
+	}
+	if m.AutoScale != nil && (live.autoScale == nil || *live.autoScale != *m.AutoScale) {
+		state := "disabled"
+		if m.AutoScale.Enabled {
+			state = "enabled"
+		}
+		changes = append(changes, manifestChange{
+			kind:        "~",
+			description: fmt.Sprintf("configure autoscale (%s, %d to %d units)", state, m.AutoScale.MinUnits, m.AutoScale.MaxUnits),
+			apply:       appCommandChange(&autoScaleConfig{}, m.Name, nil, m.AutoScale.flags()...),
+		})
+	}
+	return changes
+}
+
+func createChange(m *appManifest) manifestChange {
+	details := []string{"platform " + m.Platform}
+	if m.Plan != "" {
+		details = append(details, "plan "+m.Plan)
+	}
+	if m.TeamOwner != "" {
+		details = append(details, "team owner "+m.TeamOwner)
+	}
+	return manifestChange{
+		kind:        "+",
+		description: fmt.Sprintf("create app %s (%s)", m.Name, strings.Join(details, ", ")),
+		apply: func(context *cmd.Context, client *cmd.Client) error {
+			create := appCreate{}
+			create.Flags().Parse(true, []string{"--plan", m.Plan, "--team", m.TeamOwner})
+			ctx := cmd.Context{
+				Args:   []string{m.Name, m.Platform},
+				Stdout: context.Stdout,
+				Stderr: context.Stderr,
+				Stdin:  context.Stdin,
+			}
+			return create.Run(&ctx, client)
+		},
+	}
+}
+
+// planEnv computes the environment variables that must be set. Variables
+// that aren't in the manifest are left alone, as tsuru and the services
+// bound to the app define variables too. Private variables can't be
+// compared, so they're reported but not changed.
+func planEnv(m *appManifest, live *liveApp) []manifestChange {
+	var changes []manifestChange
+	var names []string
+	for name := range m.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var args, descriptions []string
+	for _, name := range names {
+		value := m.Env[name]
+		if value == privateEnvPlaceholder {
+			changes = append(changes, manifestChange{
+				description: fmt.Sprintf("env %s has the placeholder of a private value, replace it with the value in the manifest", name),
+			})
+			continue
+		}
+		if live.privateEnv[name] {
+			changes = append(changes, manifestChange{
+				description: fmt.Sprintf("env %s is private and can't be compared, use env-set to change it", name),
+			})
+			continue
+		}
+		current, ok := live.env[name]
+		if ok && current == value {
+			continue
+		}
+		description := fmt.Sprintf("%s=%s", name, value)
+		if ok {
+			description += fmt.Sprintf(" (was %s)", current)
+		}
+		descriptions = append(descriptions, description)
+		args = append(args, fmt.Sprintf("%s=%s", name, value))
+	}
+	if len(args) > 0 {
+		changes = append(changes, manifestChange{
+			kind:        "~",
+			description: "set env " + strings.Join(descriptions, ", "),
+			apply:       appCommandChange(&envSet{}, m.Name, args),
+		})
+	}
+	return changes
+}
+
+// appCommandChange returns a function that applies a change by running the
+// given command against the app, with the given arguments and flags.
+func appCommandChange(command cmd.FlaggedCommand, appName string, args []string, flags ...string) func(*cmd.Context, *cmd.Client) error {
+	return func(context *cmd.Context, client *cmd.Client) error {
+		err := command.Flags().Parse(true, append([]string{"-a", appName}, flags...))
+		if err != nil {
+			return err
+		}
+		ctx := cmd.Context{
+			Args:   args,
+			Stdout: context.Stdout,
+			Stderr: context.Stderr,
+			Stdin:  context.Stdin,
+		}
+		return command.Run(&ctx, client)
+	}
+}
+
+// diffStrings returns the values of desired missing from current, and the
+// values of current missing from desired.
+func diffStrings(current, desired []string) (added, removed []string) {
+	for _, value := range desired {
+		if !containsString(current, value) && !containsString(added, value) {
+			added = append(added, value)
+		}
+	}
+	for _, value := range current {
+		if !containsString(desired, value) {
+			removed = append(removed, value)
+		}
+	}
+	return added, removed
+}
+
+type apply struct {
+	cmd.ConfirmationCommand
+	file string
+	fs   *gnuflag.FlagSet
+}
+
+func (c *apply) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "apply",
+		Usage: "apply [-f/--file tsuru.yaml] [-y/--assume-yes]",
+		Desc: `Brings an app to the state described by a manifest file, creating the app
+when it doesn't exist.
+
+The manifest is a YAML file, tsuru.yaml by default, that may also contain the
+deploy hooks (see [[tsuru app-deploy]]). For example::
+
+    name: myapp
+    platform: python
+    plan: small
+    team-owner: myteam
+    teams: [myteam, ops]
+    cnames: [myapp.example.com]
+    env:
+      DEBUG: "false"
+    units: 3
+    services: [myapp-mysql]
+    autoscale:
+      enabled: true
+      min-units: 2
+      max-units: 10
+      increase: {step: 1, wait: 300, expression: "{cpu_max} > 80"}
+      decrease: {step: 1, wait: 300, expression: "{cpu_max} < 20"}
+
+Only the name is required. The teams, cnames and services lists are the
+complete lists of the app: teams, cnames and service instances missing from
+them are removed from the app. Environment variables not in the manifest are
+left alone, and private ones can't be compared, so they're not changed. The
+platform and plan of existing apps can't be changed. The autoscale
+configuration is replaced as a whole when it differs from the one of the app,
+so the fields left out of it are set to zero.
+
+The command compares the manifest with the current state of the app and shows
+the plan of the changes, applying them after confirmation. When the app is
+created, the remaining changes are planned again after the creation, as the
+app may start with teams and units not in the manifest, and they're confirmed
+before being applied.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *apply) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = cmd.MergeFlagSet(
+			gnuflag.NewFlagSet("", gnuflag.ExitOnError),
+			c.ConfirmationCommand.Flags(),
+		)
+		c.fs.StringVar(&c.file, "file", "tsuru.yaml", "The manifest describing the app")
+		c.fs.StringVar(&c.file, "f", "tsuru.yaml", "The manifest describing the app")
+	}
+	return c.fs
+}
+
+func (c *apply) Run(context *cmd.Context, client *cmd.Client) error {
+	manifest, err := readManifest(c.file)
+	if err != nil {
+		return err
+	}
+	live, err := loadLiveApp(client, manifest)
+	if err != nil {
+		return err
+	}
+	if live == nil && manifest.Platform == "" {
+		return fmt.Errorf("app %q doesn't exist and the manifest has no platform to create it", manifest.Name)
+	}
+	changes := planManifest(manifest, live)
+	fmt.Fprintf(context.Stdout, "Plan for app %q:\n", manifest.Name)
+	if !c.confirmChanges(context, manifest.Name, changes) {
+		return nil
+	}
+	if live == nil {
+		fmt.Fprintf(context.Stdout, "Applying: %s\n", changes[0].description)
+		err = changes[0].apply(context, client)
+		if err != nil {
+			return fmt.Errorf("could not create app %q: %s", manifest.Name, err)
+		}
+		// The teams that have access to the app are only known after it's
+		// created, so the remaining changes are computed again.
+		live, err = loadLiveApp(client, manifest)
+		if err != nil {
+			return err
+		}
+		if live == nil {
+			return fmt.Errorf("app %q was not found after being created", manifest.Name)
+		}
+		changes = planManifest(manifest, live)
+		fmt.Fprintf(context.Stdout, "Plan for the remaining changes of app %q:\n", manifest.Name)
+		if !c.confirmChanges(context, manifest.Name, changes) {
+			return nil
+		}
+	}
+	for _, change := range changes {
+		if change.apply == nil {
+			continue
+		}
+		fmt.Fprintf(context.Stdout, "Applying: %s\n", change.description)
+		err = change.apply(context, client)
+		if err != nil {
+			return fmt.Errorf("could not %s: %s", change.description, err)
+		}
+	}
+	fmt.Fprintf(context.Stdout, "App %q successfully updated!\n", manifest.Name)
+	return nil
+}
+
+// confirmChanges displays the changes of the plan, asking for confirmation
+// when any of them can be applied. The app is only reported as up to date
+// when the plan has no changes at all.
+func (c *apply) confirmChanges(context *cmd.Context, appName string, changes []manifestChange) bool {
+	var pending int
+	for _, change := range changes {
+		fmt.Fprintf(context.Stdout, "  %s\n", change)
+		if change.apply != nil {
+			pending++
+		}
+	}
+	if len(changes) == 0 {
+		fmt.Fprintln(context.Stdout, "  no changes, the app is up to date")
+		return false
+	}
+	if pending == 0 {
+		fmt.Fprintln(context.Stdout, "  none of the changes can be applied")
+		return false
+	}
+	return c.Confirm(context, fmt.Sprintf("Apply %d changes to app %q?", pending, appName))
+}
+
+// loadLiveApp loads the state of the app described by the manifest, along
+// with its autoscale configuration when the manifest has one.
+func loadLiveApp(client *cmd.Client, m *appManifest) (*liveApp, error) {
+	live, err := getLiveApp(client, m.Name)
+	if err != nil || live == nil || m.AutoScale == nil {
+		return live, err
+	}
+	live.autoScale, err = getAutoScale(client, m.Name)
+	if err != nil {
+		return nil, err
+	}
+	return live, nil
+}
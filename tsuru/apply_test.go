@@ -0,0 +1,372 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+const testManifest = `name: app1
+platform: python
+plan: small
+team-owner: myteam
+teams: [myteam, ops]
+cnames: [app1.example.com]
+env:
+  DEBUG: "false"
+  WORKERS: "4"
+  SECRET: "xyz"
+units: 3
+services: [mysql1]
+autoscale:
+  enabled: true
+  min-units: 2
+  max-units: 10
+  increase:
+    step: 2
+    expression: "{cpu_max} > 80"
+client-hooks:
+  pre-deploy:
+    - make test
+`
+
+// fakeAPI answers the requests of the apply tests from a set of routes,
+// identified by method and path, recording the requests that change the
+// app.
+type fakeAPI struct {
+	routes  map[string][]string
+	changes []string
+}
+
+func (a *fakeAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	route := req.Method + " " + req.URL.Path
+	status, body := http.StatusOK, ""
+	if responses, ok := a.routes[route]; ok && len(responses) > 0 {
+		response := responses[0]
+		if len(responses) > 1 {
+			a.routes[route] = responses[1:]
+		}
+		if strings.HasPrefix(response, "404 ") {
+			status, response = http.StatusNotFound, response[4:]
+		}
+		body = response
+	}
+	if req.Method != "GET" {
+		change := route
+		if req.Body != nil {
+			b, _ := ioutil.ReadAll(req.Body)
+			if len(b) > 0 {
+				change += " " + strings.TrimSpace(string(b))
+			}
+		}
+		a.changes = append(a.changes, change)
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		StatusCode: status,
+	}, nil
+}
+
+func newFakeAPI() *fakeAPI {
+	return &fakeAPI{routes: map[string][]string{
+		"GET /apps/app1":                         {`{"name":"app1","platform":"python","teamowner":"myteam","teams":["myteam","qa"],"cname":["old.example.com"],"plan":{"name":"small"},"units":[{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"started"}]}`},
+		"GET /apps/app1/env":                     {`[{"name":"DEBUG","value":"true","public":true},{"name":"WORKERS","value":"4","public":true},{"name":"SECRET","value":"","public":false}]`},
+		"GET /services/instances":                {`[{"service":"mysql","instances":["mysql1"]},{"service":"redis","instances":["redis1"]}]`},
+		"POST /apps/app1/env":                    {""},
+		"PUT /apps/app1/units":                   {""},
+		"DELETE /services/instances/redis1/app1": {""},
+	}}
+}
+
+func runApply(c *check.C, api *fakeAPI, manifest, stdin string, args ...string) (string, error) {
+	fsystem = &fstest.RecordingFs{FileContent: manifest}
+	defer func() {
+		fsystem = nil
+	}()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		// hides UnreadRune, so each confirmation consumes its line as it
+		// does when reading from a terminal.
+		Stdin: struct{ io.Reader }{strings.NewReader(stdin)},
+	}
+	client := cmd.NewClient(&http.Client{Transport: api}, nil, manager)
+	command := apply{}
+	err := command.Flags().Parse(true, args)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	return stdout.String(), err
+}
+
+func (s *S) TestApplyInfo(c *check.C) {
+	c.Assert((&apply{}).Info(), check.NotNil)
+}
+
+func (s *S) TestApplyIsAFlaggedCommand(c *check.C) {
+	var _ cmd.FlaggedCommand = &apply{}
+}
+
+func (s *S) TestReadManifest(c *check.C) {
+	rfs := &fstest.RecordingFs{FileContent: testManifest}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	manifest, err := readManifest("deploy/tsuru.yaml")
+	c.Assert(err, check.IsNil)
+	c.Assert(rfs.HasAction("open deploy/tsuru.yaml"), check.Equals, true)
+	units := 3
+	c.Assert(manifest, check.DeepEquals, &appManifest{
+		Name:      "app1",
+		Platform:  "python",
+		Plan:      "small",
+		TeamOwner: "myteam",
+		Teams:     []string{"myteam", "ops"},
+		CNames:    []string{"app1.example.com"},
+		Env:       map[string]string{"DEBUG": "false", "WORKERS": "4", "SECRET": "xyz"},
+		Units:     &units,
+		Services:  []string{"mysql1"},
+		AutoScale: &manifestAutoScale{
+			Enabled:  true,
+			MinUnits: 2,
+			MaxUnits: 10,
+			Increase: manifestScaleAction{Step: 2, Expression: "{cpu_max} > 80"},
+		},
+	})
+	c.Assert(manifest.AutoScale.flags(), check.DeepEquals, []string{
+		"--min-units", "2", "--max-units", "10",
+		"--increase-step", "2", "--increase-wait-time", "0", "--increase-expression", "{cpu_max} > 80",
+		"--decrease-step", "0", "--decrease-wait-time", "0", "--decrease-expression", "",
+		"--enabled",
+	})
+}
+
+func (s *S) TestReadManifestInvalid(c *check.C) {
+	fsystem = &fstest.RecordingFs{FileContent: "platform: python\n"}
+	defer func() {
+		fsystem = nil
+	}()
+	_, err := readManifest("tsuru.yaml")
+	c.Assert(err, check.ErrorMatches, "invalid manifest tsuru.yaml: the name of the app is required")
+	fsystem = &fstest.RecordingFs{FileContent: "name: app1\nunits: -1\n"}
+	_, err = readManifest("tsuru.yaml")
+	c.Assert(err, check.ErrorMatches, "invalid manifest tsuru.yaml: the number of units can't be negative")
+}
+
+func (s *S) TestPlanManifest(c *check.C) {
+	units := 1
+	manifest := &appManifest{
+		Name:     "app1",
+		Platform: "go",
+		Plan:     "small",
+		Teams:    []string{"myteam"},
+		Env:      map[string]string{"DEBUG": "false", "NEW": "1", "SECRET": "xyz"},
+		Units:    &units,
+	}
+	live := &liveApp{
+		app: &app{
+			Name:      "app1",
+			Platform:  "python",
+			TeamOwner: "myteam",
+			Teams:     []string{"myteam"},
+			Units:     []unit{{Name: "app1/0"}, {Name: "app1/1"}, {Name: "app1/2"}},
+		},
+		env:        map[string]string{"DEBUG": "true"},
+		privateEnv: map[string]bool{"SECRET": true},
+	}
+	changes := planManifest(manifest, live)
+	var lines []string
+	for _, change := range changes {
+		lines = append(lines, change.String())
+	}
+	c.Assert(lines, check.DeepEquals, []string{
+		"! platform can't be changed from python to go by apply",
+		"! env SECRET is private and can't be compared, use env-set to change it",
+		"~ set env DEBUG=false (was true), NEW=1",
+		"- remove 2 units (3 -> 1)",
+	})
+}
+
+func (s *S) TestPlanManifestMissingAppWithoutPlatform(c *check.C) {
+	changes := planManifest(&appManifest{Name: "app1", Teams: []string{"ops"}}, nil)
+	c.Assert(changes, check.HasLen, 1)
+	c.Assert(changes[0].String(), check.Equals, "! app app1 doesn't exist and the manifest has no platform to create it")
+}
+
+func (s *S) TestApply(c *check.C) {
+	api := newFakeAPI()
+	out, err := runApply(c, api, testManifest, "", "-y")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s)Plan for app "app1":
+  \+ grant access to team ops
+  - revoke access from team qa
+  \+ add cname app1.example.com
+  - remove cname old.example.com
+  ! env SECRET is private and can't be compared, use env-set to change it
+  ~ set env DEBUG=false \(was true\)
+  - unbind service instance redis1
+  \+ add 1 units \(2 -> 3\)
+  ~ configure autoscale \(enabled, 2 to 10 units\)
+Applying: grant access to team ops
+.*App "app1" successfully updated!
+`)
+	c.Assert(api.changes, check.DeepEquals, []string{
+		"PUT /apps/app1/teams/ops",
+		"DELETE /apps/app1/teams/qa",
+		`POST /apps/app1/cname {"cname":["app1.example.com"]}`,
+		`DELETE /apps/app1/cname {"cname":["old.example.com"]}`,
+		`POST /apps/app1/env {"DEBUG":"false"}`,
+		"DELETE /services/instances/redis1/app1",
+		"PUT /apps/app1/units 1",
+		`PUT /autoscale/app1 {"Increase":{"Wait":0,"Expression":"{cpu_max} \u003e 80","Units":2},"Decrease":{"Wait":0,"Expression":"","Units":0},"MinUnits":2,"MaxUnits":10,"Enabled":true}`,
+	})
+}
+
+func (s *S) TestApplyAutoScale(c *check.C) {
+	manifest := `name: app1
+autoscale:
+  enabled: false
+  min-units: 0
+  max-units: 5
+  increase: {step: 1, wait: 300, expression: "{cpu_max} > 80"}
+  decrease: {step: 1, wait: 60, expression: "{cpu_max} < 10"}
+`
+	api := newFakeAPI()
+	api.routes["GET /autoscale/app1"] = []string{`{"Increase":{"Wait":300000000000,"Expression":"{cpu_max} > 80","Units":1},"Decrease":{"Wait":60000000000,"Expression":"{cpu_max} < 10","Units":1},"MinUnits":0,"MaxUnits":5,"Enabled":false}`}
+	out, err := runApply(c, api, manifest, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Plan for app \"app1\":\n  no changes, the app is up to date\n")
+	c.Assert(api.changes, check.HasLen, 0)
+	api.routes["GET /autoscale/app1"] = []string{`{"Increase":{"Wait":300000000000,"Expression":"{cpu_max} > 80","Units":1},"Decrease":{"Wait":60000000000,"Expression":"{cpu_max} < 10","Units":1},"MinUnits":1,"MaxUnits":5,"Enabled":false}`}
+	out, err = runApply(c, api, manifest, "", "-y")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s)Plan for app "app1":
+  ~ configure autoscale \(disabled, 0 to 5 units\)
+.*`)
+	c.Assert(api.changes, check.DeepEquals, []string{
+		`PUT /autoscale/app1 {"Increase":{"Wait":300000000000,"Expression":"{cpu_max} \u003e 80","Units":1},"Decrease":{"Wait":60000000000,"Expression":"{cpu_max} \u003c 10","Units":1},"MinUnits":0,"MaxUnits":5,"Enabled":false}`,
+	})
+}
+
+func (s *S) TestApplyAbort(c *check.C) {
+	api := newFakeAPI()
+	out, err := runApply(c, api, testManifest, "n\n")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s).*Apply 8 changes to app "app1"\? \(y/n\) Abort.\n`)
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestApplyUpToDate(c *check.C) {
+	api := newFakeAPI()
+	manifest := `name: app1
+platform: python
+teams: [myteam, qa]
+env:
+  WORKERS: "4"
+units: 2
+`
+	out, err := runApply(c, api, manifest, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Plan for app \"app1\":\n  no changes, the app is up to date\n")
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestApplyNoApplicableChanges(c *check.C) {
+	api := newFakeAPI()
+	manifest := `name: app1
+platform: go
+teams: [myteam, qa]
+env:
+  WORKERS: "4"
+units: 2
+`
+	out, err := runApply(c, api, manifest, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Plan for app \"app1\":\n  ! platform can't be changed from python to go by apply\n  none of the changes can be applied\n")
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestApplyMissingAppWithoutPlatform(c *check.C) {
+	api := newFakeAPI()
+	api.routes["GET /apps/app1"] = []string{"404 App app1 not found."}
+	out, err := runApply(c, api, "name: app1\nteams: [myteam]\n", "", "-y")
+	c.Assert(err, check.ErrorMatches, `app "app1" doesn't exist and the manifest has no platform to create it`)
+	c.Assert(out, check.Equals, "")
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestApplyCreatesApp(c *check.C) {
+	api := newFakeAPI()
+	api.routes["GET /apps/app1"] = []string{
+		"404 App app1 not found.",
+		`{"name":"app1","platform":"python","teamowner":"myteam","teams":["myteam","qa"],"units":[{"Name":"app1/0","Status":"started"}]}`,
+	}
+	api.routes["GET /apps/app1/env"] = []string{"[]"}
+	api.routes["GET /services/instances"] = []string{"[]"}
+	api.routes["POST /apps"] = []string{`{"status":"success"}`}
+	manifest := `name: app1
+platform: python
+team-owner: myteam
+teams: [myteam]
+units: 2
+`
+	out, err := runApply(c, api, manifest, "y\ny\n")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s)Plan for app "app1":
+  \+ create app app1 \(platform python, team owner myteam\)
+  \+ add 2 units \(0 -> 2\)
+Apply 2 changes to app "app1"\? \(y/n\) Applying: create app app1 .*
+App "app1" has been created!
+.*Plan for the remaining changes of app "app1":
+  - revoke access from team qa
+  \+ add 1 units \(1 -> 2\)
+Apply 2 changes to app "app1"\? \(y/n\) Applying: revoke access from team qa
+.*Applying: add 1 units \(1 -> 2\)
+App "app1" successfully updated!
+`)
+	c.Assert(api.changes, check.DeepEquals, []string{
+		`POST /apps {"name":"app1","plan":{"name":""},"platform":"python","teamOwner":"myteam"}`,
+		"DELETE /apps/app1/teams/qa",
+		"PUT /apps/app1/units 1",
+	})
+}
+
+func (s *S) TestApplyCreatesAppAbortRemainingChanges(c *check.C) {
+	api := newFakeAPI()
+	api.routes["GET /apps/app1"] = []string{
+		"404 App app1 not found.",
+		`{"name":"app1","platform":"python","teamowner":"myteam","teams":["myteam","qa"],"units":[{"Name":"app1/0","Status":"started"}]}`,
+	}
+	api.routes["GET /apps/app1/env"] = []string{"[]"}
+	api.routes["GET /services/instances"] = []string{"[]"}
+	api.routes["POST /apps"] = []string{`{"status":"success"}`}
+	manifest := "name: app1\nplatform: python\nteam-owner: myteam\nteams: [myteam]\n"
+	out, err := runApply(c, api, manifest, "y\nn\n")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s).*Plan for the remaining changes of app "app1":
+  - revoke access from team qa
+Apply 1 changes to app "app1"\? \(y/n\) Abort.
+`)
+	c.Assert(api.changes, check.DeepEquals, []string{
+		`POST /apps {"name":"app1","plan":{"name":""},"platform":"python","teamOwner":"myteam"}`,
+	})
+}
+
+func (s *S) TestApplyFailure(c *check.C) {
+	api := newFakeAPI()
+	api.routes["PUT /apps/app1/teams/ops"] = []string{"404 Team not found"}
+	_, err := runApply(c, api, testManifest, "", "-y")
+	c.Assert(err, check.ErrorMatches, "could not grant access to team ops: Team not found")
+	c.Assert(api.changes, check.DeepEquals, []string{"PUT /apps/app1/teams/ops"})
+}
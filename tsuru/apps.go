@@ -12,12 +12,16 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
 
 	tsuruapp "github.com/tsuru/tsuru/app"
 	"github.com/tsuru/tsuru/cmd"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"launchpad.net/gnuflag"
 )
@@ -171,15 +175,60 @@ func (c *appRemove) Flags() *gnuflag.FlagSet {
 
 type appInfo struct {
 	cmd.GuessingCommand
+	output outputFormat
+	watch  watchFlag
+	units  bool
+	fs     *gnuflag.FlagSet
+}
+
+func (c *appInfo) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.output.addFlags(c.fs)
+		c.fs.Var(&c.watch, "watch", "Refresh the output every two seconds, or in the given interval (e.g. --watch=10s), until interrupted")
+		c.fs.BoolVar(&c.units, "units", false, "Show the details of each unit of the app, including its container")
+	}
+	return c.fs
 }
 
 func (c *appInfo) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-info",
-		Usage: "app-info [-a/--app appname]",
+		Usage: "app-info [-a/--app appname] [--units] [--watch[=interval]] [--format table|json|yaml|template] [--template <template>]",
 		Desc: `Shows information about an specific app. Its state, platform, git repository,
 etc. You need to be a member of a team that access to the app to be able to
-see informations about it.`,
+see informations about it.
+
+When the containers or the service instances of the app can't be loaded, a
+warning describing the failure, like a permission error or a network failure,
+is printed and the rest of the information is still displayed.
+
+The [[--format]] flag prints the app in the json, yaml or template formats,
+with the fields: name, platform, repository, teams, owner, team_owner, ip,
+cnames, ready, deploys, units (name, ip and status), plan (name, memory,
+swap, cpushare, router and default), containers (id, type, ip, host_addr,
+host_port, ssh_host_port, status, version, image and last_status_update) and
+services (service and instances).
+
+The [[--template]] flag prints the app using the given Go template, executed
+against the app as decoded from the API. Besides the Name, Platform,
+Repository, Teams, Owner, TeamOwner, Ip, CName, Ready, Deploys, Units (Name,
+Ip and Status) and Plan (Name, Memory, Swap, CpuShare, Router and Default)
+fields, templates can use Addr, Containers, Services and UnitsWithStatus. For
+example, to print the address of the app and the number of started units::
+
+    $ tsuru app-info -a myapp --template '{{.Addr}} {{len (.UnitsWithStatus "started")}}'
+
+The [[--watch]] flag refreshes the app information every two seconds, or in
+the given interval (e.g. [[--watch=10s]]), until interrupted with Ctrl-C. In a
+terminal, the output is redrawn in place and the units whose status changed
+in the last refresh are highlighted. Otherwise only the status changes are
+printed, one per line, prefixed by the time they were noticed.
+
+The [[--units]] flag shows the details of each unit instead: the full record
+of its container, how long it has been in its current status and the image it
+runs. Units running an image older than the newest one used by the app are
+marked as outdated. See also [[tsuru unit-info]].`,
 		MinArgs: 0,
 	}
 }
@@ -189,61 +238,165 @@ func (c *appInfo) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s", appName))
-	if err != nil {
-		return err
+	if c.units && (c.watch.enabled || !c.output.isDefault()) {
+		return errors.New("--units can't be used with --watch, --format or --template")
 	}
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
+	if c.watch.enabled {
+		if !c.output.isDefault() {
+			return errors.New("--watch can't be used with --format or --template")
+		}
+		title := fmt.Sprintf("tsuru app-info -a %s", appName)
+		return watch(context, title, c.watch.interval, func() (*watchSnapshot, error) {
+			a, err := getAppInfo(client, appName)
+			if err != nil {
+				return nil, err
+			}
+			if a == nil {
+				return nil, fmt.Errorf("app %q not found", appName)
+			}
+			return &watchSnapshot{
+				statuses: a.unitStatuses(),
+				render: func(changed map[string]bool) string {
+					a.changed = changed
+					var buf bytes.Buffer
+					buf.WriteString(a.String())
+					writeWarnings(&buf, a.warnings)
+					return buf.String()
+				},
+			}, nil
+		})
+	}
+	a, err := getAppInfo(client, appName)
+	if err != nil || a == nil {
+		return err
+	}
+	return c.Show(a, context)
+}
+
+// appInfoTimeout is the time app-info waits for the responses of the API,
+// shared by the requests for the app, its containers and its services.
+var appInfoTimeout = 30 * time.Second
+
+// getAppInfo loads the app, along with its containers and service instances,
+// requesting them concurrently. It returns nil when the API has no content
+// for the app.
+//
+// Failing to load the app is an error, while failing to load its containers
+// or services is reported in the warnings of the returned app.
+func getAppInfo(client *cmd.Client, appName string) (*app, error) {
+	paths := []string{
+		fmt.Sprintf("/apps/%s", appName),
+		fmt.Sprintf("/docker/node/apps/%s/containers", appName),
+		fmt.Sprintf("/services/instances?app=%s", appName),
+	}
+	results := make([]chan apiResult, len(paths))
+	for i, path := range paths {
+		results[i] = make(chan apiResult, 1)
+		go func(path string, result chan<- apiResult) {
+			body, status, err := apiGet(client, path)
+			result <- apiResult{body: body, status: status, err: err}
+		}(path, results[i])
+	}
+	timeout := time.After(appInfoTimeout)
+	responses := make([]apiResult, len(paths))
+wait:
+	for i := range results {
+		select {
+		case responses[i] = <-results[i]:
+		case <-timeout:
+			for j := i; j < len(responses); j++ {
+				select {
+				case responses[j] = <-results[j]:
+				default:
+					responses[j].err = fmt.Errorf("timed out after %s", appInfoTimeout)
+					responses[j].timedOut = true
+				}
+			}
+			break wait
+		}
 	}
-	response, err := client.Do(request)
+	if err := responses[0].err; err != nil {
+		return nil, err
+	}
+	if responses[0].status == http.StatusNoContent {
+		return nil, nil
+	}
+	var a app
+	err := json.Unmarshal(responses[0].body, &a)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if response.StatusCode == http.StatusNoContent {
+	if err := responses[1].decode(&a.containers); err != nil {
+		a.warnings = append(a.warnings, fmt.Sprintf("could not load the containers of the app: %s", err))
+	}
+	if err := responses[2].decode(&a.services); err != nil {
+		a.warnings = append(a.warnings, fmt.Sprintf("could not load the service instances of the app: %s", err))
+	}
+	return &a, nil
+}
+
+// apiResult is the response of a request made by apiGet.
+type apiResult struct {
+	body     []byte
+	status   int
+	err      error
+	timedOut bool
+}
+
+// decode unmarshals the JSON body of the response into v, describing the
+// reason of the failure when the request failed.
+func (r *apiResult) decode(v interface{}) error {
+	if r.timedOut {
+		return r.err
+	}
+	if r.err != nil {
+		if httpErr, ok := r.err.(*tsuruErrors.HTTP); ok {
+			switch httpErr.Code {
+			case http.StatusUnauthorized, http.StatusForbidden:
+				return fmt.Errorf("permission denied (%s)", strings.TrimSpace(httpErr.Message))
+			case http.StatusNotFound:
+				return errors.New("not available in this tsuru server")
+			}
+			return fmt.Errorf("the server returned an error (%d: %s)", httpErr.Code, strings.TrimSpace(httpErr.Message))
+		}
+		return fmt.Errorf("network failure (%s)", r.err)
+	}
+	if r.status == http.StatusNoContent || len(r.body) == 0 {
 		return nil
 	}
-	defer response.Body.Close()
-	result, err := ioutil.ReadAll(response.Body)
+	err := json.Unmarshal(r.body, v)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid response (%s)", err)
 	}
-	url, err = cmd.GetURL(fmt.Sprintf("/docker/node/apps/%s/containers", appName))
+	return nil
+}
+
+func apiGet(client *cmd.Client, path string) ([]byte, int, error) {
+	url, err := cmd.GetURL(path)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	request, err = http.NewRequest("GET", url, nil)
+	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
-	}
-	response, err = client.Do(request)
-	var adminResult []byte
-	if err == nil {
-		defer response.Body.Close()
-		adminResult, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			return err
-		}
+		return nil, 0, err
 	}
-	url, err = cmd.GetURL(fmt.Sprintf("/services/instances?app=%s", appName))
+	response, err := client.Do(request)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	request, err = http.NewRequest("GET", url, nil)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
-	response, err = client.Do(request)
-	var servicesResult []byte
-	if err == nil {
-		defer response.Body.Close()
-		servicesResult, err = ioutil.ReadAll(response.Body)
-		if err != nil {
-			return err
-		}
+	return body, response.StatusCode, nil
+}
+
+// writeWarnings writes a line for each warning to w.
+func writeWarnings(w io.Writer, warnings []string) {
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "%s %s\n", cmd.Colorfy("Warning:", "yellow", "", "bold"), warning)
 	}
-	return c.Show(result, adminResult, servicesResult, context)
 }
 
 type unit struct {
@@ -271,11 +424,128 @@ type app struct {
 	containers []container
 	services   []serviceData
 	Plan       tsuruapp.Plan
+	// changed holds the units highlighted in the output of app-info
+	// --watch, by unit name.
+	changed map[string]bool
+	// warnings describes the parts of the app that could not be loaded.
+	warnings []string
+}
+
+// getApp fetches the app with the given name from the API.
+func getApp(client *cmd.Client, appName string) (*app, error) {
+	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s", appName))
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	var a app
+	err = json.NewDecoder(response.Body).Decode(&a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
 }
 
 type serviceData struct {
-	Service   string
-	Instances []string
+	Service   string   `json:"service" yaml:"service"`
+	Instances []string `json:"instances" yaml:"instances"`
+}
+
+// appView is the representation of an app in the json, yaml and template
+// output formats.
+type appView struct {
+	Name       string          `json:"name" yaml:"name"`
+	Platform   string          `json:"platform" yaml:"platform"`
+	Repository string          `json:"repository" yaml:"repository"`
+	Teams      []string        `json:"teams" yaml:"teams"`
+	Owner      string          `json:"owner" yaml:"owner"`
+	TeamOwner  string          `json:"team_owner" yaml:"team_owner"`
+	IP         string          `json:"ip" yaml:"ip"`
+	CNames     []string        `json:"cnames" yaml:"cnames"`
+	Ready      bool            `json:"ready" yaml:"ready"`
+	Deploys    uint            `json:"deploys" yaml:"deploys"`
+	Units      []unitView      `json:"units" yaml:"units"`
+	Plan       *planView       `json:"plan,omitempty" yaml:"plan,omitempty"`
+	Containers []containerView `json:"containers,omitempty" yaml:"containers,omitempty"`
+	Services   []serviceData   `json:"services,omitempty" yaml:"services,omitempty"`
+}
+
+type unitView struct {
+	Name   string `json:"name" yaml:"name"`
+	IP     string `json:"ip" yaml:"ip"`
+	Status string `json:"status" yaml:"status"`
+}
+
+type containerView struct {
+	ID               string `json:"id" yaml:"id"`
+	Type             string `json:"type" yaml:"type"`
+	IP               string `json:"ip" yaml:"ip"`
+	HostAddr         string `json:"host_addr" yaml:"host_addr"`
+	HostPort         string `json:"host_port" yaml:"host_port"`
+	SSHHostPort      string `json:"ssh_host_port" yaml:"ssh_host_port"`
+	Status           string `json:"status" yaml:"status"`
+	Version          string `json:"version" yaml:"version"`
+	Image            string `json:"image" yaml:"image"`
+	LastStatusUpdate string `json:"last_status_update" yaml:"last_status_update"`
+}
+
+func (a *app) view() appView {
+	v := appView{
+		Name:       a.Name,
+		Platform:   a.Platform,
+		Repository: a.Repository,
+		Teams:      a.Teams,
+		Owner:      a.Owner,
+		TeamOwner:  a.TeamOwner,
+		IP:         a.Ip,
+		CNames:     a.CName,
+		Ready:      a.Ready,
+		Deploys:    a.Deploys,
+		Units:      []unitView{},
+		Services:   a.services,
+	}
+	if v.Teams == nil {
+		v.Teams = []string{}
+	}
+	if v.CNames == nil {
+		v.CNames = []string{}
+	}
+	for _, unit := range a.Units {
+		if unit.Name != "" {
+			v.Units = append(v.Units, unitView{Name: unit.Name, IP: unit.Ip, Status: unit.Status})
+		}
+	}
+	if a.Plan.Name != "" {
+		plan := newPlanView(a.Plan)
+		v.Plan = &plan
+	}
+	for _, cont := range a.containers {
+		var lastUpdate string
+		if !cont.LastStatusUpdate.IsZero() {
+			lastUpdate = cont.LastStatusUpdate.Format(time.RFC3339)
+		}
+		v.Containers = append(v.Containers, containerView{
+			ID:               cont.ID,
+			Type:             cont.Type,
+			IP:               cont.IP,
+			HostAddr:         cont.HostAddr,
+			HostPort:         cont.HostPort,
+			SSHHostPort:      cont.SSHHostPort,
+			Status:           cont.Status,
+			Version:          cont.Version,
+			Image:            cont.Image,
+			LastStatusUpdate: lastUpdate,
+		})
+	}
+	return v
 }
 
 type container struct {
@@ -291,6 +561,125 @@ type container struct {
 	LastStatusUpdate time.Time
 }
 
+// unitDetail is a unit along with the record of its container, displayed by
+// app-info --units and unit-info.
+type unitDetail struct {
+	unit
+	container *container
+	// newestImage is the newest image used by the units of the app, set
+	// only when the unit runs an older image.
+	newestImage string
+}
+
+// minContainerIDPrefix is the shortest unit name matched as an abbreviation
+// of the id of a container, the length of the short ids used by docker.
+const minContainerIDPrefix = 12
+
+// unitDetails matches the units of the app with their containers. Units are
+// named after the id of their containers, usually abbreviated, so a unit
+// also matches a container whose id starts with the name of the unit, when
+// the name has at least minContainerIDPrefix characters.
+func (a *app) unitDetails() []unitDetail {
+	var details []unitDetail
+	var newest string
+	var newestVersion int
+	for _, unit := range a.Units {
+		if unit.Name == "" {
+			continue
+		}
+		detail := unitDetail{unit: unit}
+		for i := range a.containers {
+			id := a.containers[i].ID
+			if id == "" {
+				continue
+			}
+			if id == unit.Name || (len(unit.Name) >= minContainerIDPrefix && strings.HasPrefix(id, unit.Name)) {
+				detail.container = &a.containers[i]
+				break
+			}
+		}
+		if detail.container != nil {
+			if version, ok := imageVersion(detail.container.Image); ok && version > newestVersion {
+				newest, newestVersion = detail.container.Image, version
+			}
+		}
+		details = append(details, detail)
+	}
+	for i := range details {
+		if cont := details[i].container; cont != nil {
+			if version, ok := imageVersion(cont.Image); ok && version < newestVersion {
+				details[i].newestImage = newest
+			}
+		}
+	}
+	return details
+}
+
+// imageVersion extracts the version from the tag of the images built by
+// tsuru, like v3 in tsuru/app-myapp:v3.
+func imageVersion(image string) (int, bool) {
+	i := strings.LastIndex(image, ":v")
+	if i < 0 {
+		return 0, false
+	}
+	version, err := strconv.Atoi(image[i+2:])
+	return version, err == nil
+}
+
+// writeUnitDetails writes the details of each unit to w, computing how long
+// they've been in their status from now.
+func writeUnitDetails(w io.Writer, details []unitDetail, now time.Time) {
+	for i, detail := range details {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Unit: %s\n", detail.Name)
+		cont := detail.container
+		if cont == nil {
+			fmt.Fprintf(w, "Status: %s\n", detail.Status)
+			fmt.Fprintf(w, "IP: %s\n", detail.Ip)
+			fmt.Fprintln(w, "Container: not available")
+			continue
+		}
+		status := detail.Status
+		if !cont.LastStatusUpdate.IsZero() {
+			status = fmt.Sprintf("%s (for %s, since %s)", status, formatAge(now.Sub(cont.LastStatusUpdate)),
+				cont.LastStatusUpdate.Local().Format(time.Stamp))
+		}
+		fmt.Fprintf(w, "Status: %s\n", status)
+		image := cont.Image
+		if detail.newestImage != "" {
+			image += " " + cmd.Colorfy(fmt.Sprintf("(outdated, the newest image is %s)", detail.newestImage), "red", "", "")
+		}
+		fmt.Fprintf(w, "Image: %s\n", image)
+		fmt.Fprintf(w, "Version: %s\n", cont.Version)
+		fmt.Fprintf(w, "Type: %s\n", cont.Type)
+		fmt.Fprintf(w, "Container: %s\n", cont.ID)
+		fmt.Fprintf(w, "IP: %s\n", cont.IP)
+		fmt.Fprintf(w, "Host: %s:%s\n", cont.HostAddr, cont.HostPort)
+		fmt.Fprintf(w, "SSH host port: %s\n", cont.SSHHostPort)
+	}
+}
+
+// formatAge formats durations in the two most significant units, as in
+// 3d 2h or 5m 12s.
+func formatAge(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	seconds := int64(d / time.Second)
+	days, hours, minutes := seconds/86400, seconds/3600%24, seconds/60%60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds%60)
+	}
+	return fmt.Sprintf("%ds", seconds)
+}
+
 func (a *app) Addr() string {
 	cnames := strings.Join(a.CName, ", ")
 	if cnames != "" {
@@ -310,6 +699,62 @@ func (a *app) GetTeams() string {
 	return strings.Join(a.Teams, ", ")
 }
 
+// Containers returns the containers of the app, available in the templates
+// given to app-info.
+func (a *app) Containers() []container {
+	return a.containers
+}
+
+// Services returns the service instances bound to the app, available in the
+// templates given to app-info.
+func (a *app) Services() []serviceData {
+	return a.services
+}
+
+// unitStatuses returns the status of the units of the app, by unit name.
+func (a *app) unitStatuses() map[string]string {
+	statuses := map[string]string{}
+	for _, unit := range a.Units {
+		if unit.Name != "" {
+			statuses[unit.Name] = unit.Status
+		}
+	}
+	return statuses
+}
+
+// unitCount returns the number of units of the app, ignoring the empty units
+// returned by the API for apps without units.
+func (a *app) unitCount() int {
+	var total int
+	for _, unit := range a.Units {
+		if unit.Name != "" {
+			total++
+		}
+	}
+	return total
+}
+
+// healthy reports whether all units of the app are available.
+func (a *app) healthy() bool {
+	for _, unit := range a.Units {
+		if unit.Name != "" && !unit.Available() {
+			return false
+		}
+	}
+	return true
+}
+
+// UnitsWithStatus returns the units of the app in the given status.
+func (a *app) UnitsWithStatus(status string) []unit {
+	var units []unit
+	for _, unit := range a.Units {
+		if unit.Name != "" && unit.Status == status {
+			units = append(units, unit)
+		}
+	}
+	return units
+}
+
 func (a *app) String() string {
 	format := `Application: {{.Name}}
 Repository: {{.Repository}}
@@ -341,7 +786,11 @@ Deploys: {{.Deploys}}
 			if len(unit.Name) > 10 {
 				id = id[:10]
 			}
-			row := []string{id, unit.Status}
+			status := unit.Status
+			if a.changed[unit.Name] {
+				status = cmd.Colorfy(status, "yellow", "", "bold")
+			}
+			row := []string{id, status}
 			cont, ok := contMap[id]
 			if ok {
 				row = append(row, []string{cont.HostAddr, cont.HostPort, cont.IP}...)
@@ -378,16 +827,19 @@ Deploys: {{.Deploys}}
 	return buf.String() + suffix
 }
 
-func (c *appInfo) Show(result []byte, adminResult []byte, servicesResult []byte, context *cmd.Context) error {
-	var a app
-	err := json.Unmarshal(result, &a)
-	if err != nil {
-		return err
+func (c *appInfo) Show(a *app, context *cmd.Context) error {
+	writeWarnings(context.Stderr, a.warnings)
+	if c.units {
+		writeUnitDetails(context.Stdout, a.unitDetails(), time.Now())
+		return nil
 	}
-	json.Unmarshal(adminResult, &a.containers)
-	json.Unmarshal(servicesResult, &a.services)
-	fmt.Fprintln(context.Stdout, &a)
-	return nil
+	if c.output.usesTemplate() {
+		return c.output.renderTemplate(context.Stdout, a)
+	}
+	return c.output.render(context.Stdout, a.view(), func() error {
+		fmt.Fprintln(context.Stdout, a)
+		return nil
+	})
 }
 
 type appGrant struct {
@@ -466,88 +918,292 @@ func (c *appRevoke) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
-type appList struct{}
+type appList struct {
+	output   outputFormat
+	filter   appFilter
+	name     string
+	ready    bool
+	notReady bool
+	sortBy   string
+	quiet    bool
+	watch    watchFlag
+	fs       *gnuflag.FlagSet
+}
+
+func (c *appList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-list", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+		c.fs.StringVar(&c.filter.team, "team", "", "List only apps the given team has access to")
+		c.fs.StringVar(&c.filter.owner, "owner", "", "List only apps owned by the given user")
+		c.fs.StringVar(&c.filter.platform, "platform", "", "List only apps using the given platform")
+		c.fs.StringVar(&c.filter.plan, "plan", "", "List only apps using the given plan")
+		c.fs.StringVar(&c.name, "name", "", "List only apps whose name matches the given regular expression")
+		c.fs.BoolVar(&c.ready, "ready", false, "List only apps that are ready")
+		c.fs.BoolVar(&c.notReady, "not-ready", false, "List only apps that are not ready")
+		c.fs.BoolVar(&c.filter.unhealthy, "unhealthy", false, "List only apps with units that are not available")
+		c.fs.StringVar(&c.sortBy, "sort-by", "name", "Sort the apps by name, units or platform")
+		c.fs.BoolVar(&c.quiet, "quiet", false, "Print only the names of the apps")
+		c.fs.BoolVar(&c.quiet, "q", false, "Print only the names of the apps")
+		c.fs.Var(&c.watch, "watch", "Refresh the list every two seconds, or in the given interval (e.g. --watch=10s), until interrupted")
+	}
+	return c.fs
+}
+
+// appFilter selects the apps displayed by app-list.
+type appFilter struct {
+	team      string
+	owner     string
+	platform  string
+	plan      string
+	name      *regexp.Regexp
+	ready     *bool
+	unhealthy bool
+}
+
+func (f *appFilter) match(a *app) bool {
+	if f.team != "" && a.TeamOwner != f.team && !containsString(a.Teams, f.team) {
+		return false
+	}
+	if f.owner != "" && a.Owner != f.owner {
+		return false
+	}
+	if f.platform != "" && a.Platform != f.platform {
+		return false
+	}
+	if f.plan != "" && a.Plan.Name != f.plan {
+		return false
+	}
+	if f.name != nil && !f.name.MatchString(a.Name) {
+		return false
+	}
+	if f.ready != nil && a.Ready != *f.ready {
+		return false
+	}
+	if f.unhealthy && a.healthy() {
+		return false
+	}
+	return true
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare validates the flags of the command, filling the parts of the
+// filter that depend on more than one flag.
+func (c *appList) prepare() error {
+	if c.ready && c.notReady {
+		return errors.New("please use only one of --ready and --not-ready")
+	}
+	if c.ready || c.notReady {
+		ready := c.ready
+		c.filter.ready = &ready
+	}
+	if c.name != "" {
+		regex, err := regexp.Compile(c.name)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression in --name: %s", err)
+		}
+		c.filter.name = regex
+	}
+	switch c.sortBy {
+	case "", "name", "units", "platform":
+	default:
+		return fmt.Errorf("invalid value for --sort-by: %q, use name, units or platform", c.sortBy)
+	}
+	if c.quiet && !c.output.isDefault() {
+		return errors.New("please use only one of --quiet and --format/--template")
+	}
+	if c.watch.enabled && (c.quiet || !c.output.isDefault()) {
+		return errors.New("--watch can't be used with --quiet, --format or --template")
+	}
+	return nil
+}
 
 func (c appList) Run(context *cmd.Context, client *cmd.Client) error {
-	url, err := cmd.GetURL("/apps")
+	err := c.prepare()
 	if err != nil {
 		return err
 	}
+	if c.watch.enabled {
+		return watch(context, "tsuru app-list", c.watch.interval, func() (*watchSnapshot, error) {
+			apps, err := c.fetch(client)
+			if err != nil {
+				return nil, err
+			}
+			statuses := map[string]string{}
+			for _, a := range apps {
+				for name, status := range a.unitStatuses() {
+					statuses[name] = status
+				}
+			}
+			return &watchSnapshot{
+				statuses: statuses,
+				render: func(changed map[string]bool) string {
+					return c.table(apps, changed).String()
+				},
+			}, nil
+		})
+	}
+	apps, err := c.fetch(client)
+	if err != nil || apps == nil {
+		return err
+	}
+	return c.Show(apps, context)
+}
+
+// fetch loads the apps that match the filters, in the order they should be
+// displayed. It returns nil when the API has no content.
+func (c *appList) fetch(client *cmd.Client) ([]app, error) {
+	url, err := cmd.GetURL("/apps")
+	if err != nil {
+		return nil, err
+	}
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	response, err := client.Do(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if response.StatusCode == http.StatusNoContent {
-		return nil
+		return nil, nil
 	}
 	defer response.Body.Close()
-	result, err := ioutil.ReadAll(response.Body)
+	var all []app
+	err = json.NewDecoder(response.Body).Decode(&all)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	apps := make([]app, 0, len(all))
+	for _, a := range all {
+		if c.filter.match(&a) {
+			apps = append(apps, a)
+		}
+	}
+	sort.Sort(appsByName(apps))
+	switch c.sortBy {
+	case "units":
+		sort.Stable(appsByUnits(apps))
+	case "platform":
+		sort.Stable(appsByPlatform(apps))
 	}
-	return c.Show(result, context)
+	return apps, nil
 }
 
-func (c appList) Show(result []byte, context *cmd.Context) error {
-	var apps []app
-	err := json.Unmarshal(result, &apps)
-	if err != nil {
-		return err
+func (c appList) Show(apps []app, context *cmd.Context) error {
+	if c.quiet {
+		for _, a := range apps {
+			fmt.Fprintln(context.Stdout, a.Name)
+		}
+		return nil
 	}
+	if c.output.usesTemplate() {
+		items := make([]*app, len(apps))
+		for i := range apps {
+			items[i] = &apps[i]
+		}
+		return c.output.renderTemplate(context.Stdout, items)
+	}
+	views := make([]appView, len(apps))
+	for i := range apps {
+		views[i] = apps[i].view()
+	}
+	return c.output.render(context.Stdout, views, func() error {
+		_, err := context.Stdout.Write(c.table(apps, nil).Bytes())
+		return err
+	})
+}
+
+// table builds the default output of app-list, highlighting the apps with
+// units in the changed set.
+func (c appList) table(apps []app, changed map[string]bool) *cmd.Table {
 	table := cmd.NewTable()
 	table.Headers = cmd.Row([]string{"Application", "Units State Summary", "Address", "Ready?"})
 	for _, app := range apps {
 		var available int
-		var total int
+		var highlight bool
 		for _, unit := range app.Units {
-			if unit.Name != "" {
-				total++
-				if unit.Available() {
-					available += 1
-				}
+			if unit.Name != "" && unit.Available() {
+				available += 1
 			}
+			highlight = highlight || changed[unit.Name]
+		}
+		summary := fmt.Sprintf("%d of %d units in-service", available, app.unitCount())
+		if highlight {
+			summary = cmd.Colorfy(summary, "yellow", "", "bold")
 		}
-		summary := fmt.Sprintf("%d of %d units in-service", available, total)
 		addrs := strings.Replace(app.Addr(), ", ", "\n", -1)
 		table.AddRow(cmd.Row([]string{app.Name, summary, addrs, app.IsReady()}))
 	}
 	table.LineSeparator = true
-	table.Sort()
-	context.Stdout.Write(table.Bytes())
-	return nil
+	return table
 }
 
 func (c appList) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-list",
-		Usage: "app-list",
+		Usage: "app-list [--team team] [--owner user] [--platform platform] [--plan plan] [--name regex] [--ready|--not-ready] [--unhealthy] [--sort-by name|units|platform] [-q/--quiet] [--watch[=interval]] [--format table|json|yaml|template] [--template <template>]",
 		Desc: `Lists all apps that you have access to. App access is controlled by teams. If
-your team has access to an app, then you have access to it.`,
+your team has access to an app, then you have access to it.
+
+The list can be filtered by the team that has access to the apps
+([[--team]]), the user that owns them ([[--owner]]), their platform
+([[--platform]]) and plan ([[--plan]]), a regular expression matched against
+their names ([[--name]]), whether they're ready ([[--ready]] and
+[[--not-ready]]) and whether any of their units is not available
+([[--unhealthy]]). All filters given must match.
+
+Apps are sorted by name, unless [[--sort-by]] is used: [[units]] lists the
+apps with more units first, and [[platform]] groups the apps by platform. The
+[[-q/--quiet]] flag prints only the names of the apps, one per line, to be used
+in scripts.
+
+The [[--format]] flag prints the apps in the json, yaml or template formats,
+with the same fields displayed by [[tsuru app-info]], except for containers
+and services.
+
+The [[--template]] flag executes the given Go template against each app, in
+the same way as [[tsuru app-info]]. For example, to print the name of the
+apps that have no started units::
+
+    $ tsuru app-list --template '{{if not (.UnitsWithStatus "started")}}{{.Name}}{{end}}'
+
+The [[--watch]] flag refreshes the list until interrupted, in the same way as
+[[tsuru app-info]], highlighting the apps with units whose status changed.`,
 	}
 }
 
 type appStop struct {
 	cmd.GuessingCommand
+	batch appBatch
 }
 
 func (c *appStop) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-stop",
-		Usage:   "app-stop [-a/--app appname]",
-		Desc:    `Stops an application.`,
+		Usage:   "app-stop " + batchUsage,
+		Desc:    `Stops an application.` + "\n\n" + fmt.Sprintf(batchDesc, "app-stop"),
 		MinArgs: 0,
 	}
 }
 
+func (c *appStop) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
+}
+
 func (c *appStop) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
+	return c.batch.run(context, client, &c.GuessingCommand, c.stop)
+}
+
+func (c *appStop) stop(context *cmd.Context, client *cmd.Client, appName string) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/stop", appName))
 	if err != nil {
 		return err
@@ -570,22 +1226,27 @@ func (c *appStop) Run(context *cmd.Context, client *cmd.Client) error {
 
 type appStart struct {
 	cmd.GuessingCommand
+	batch appBatch
 }
 
 func (c *appStart) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-start",
-		Usage:   "app-start [-a/--app appname]",
-		Desc:    `Starts an application.`,
+		Usage:   "app-start " + batchUsage,
+		Desc:    `Starts an application.` + "\n\n" + fmt.Sprintf(batchDesc, "app-start"),
 		MinArgs: 0,
 	}
 }
 
+func (c *appStart) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
+}
+
 func (c *appStart) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
+	return c.batch.run(context, client, &c.GuessingCommand, c.start)
+}
+
+func (c *appStart) start(context *cmd.Context, client *cmd.Client, appName string) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/start", appName))
 	if err != nil {
 		return err
@@ -608,13 +1269,18 @@ func (c *appStart) Run(context *cmd.Context, client *cmd.Client) error {
 
 type appRestart struct {
 	cmd.GuessingCommand
+	batch appBatch
+}
+
+func (c *appRestart) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
 }
 
 func (c *appRestart) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
+	return c.batch.run(context, client, &c.GuessingCommand, c.restart)
+}
+
+func (c *appRestart) restart(context *cmd.Context, client *cmd.Client, appName string) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/restart", appName))
 	if err != nil {
 		return err
@@ -644,8 +1310,8 @@ func (c *appRestart) Run(context *cmd.Context, client *cmd.Client) error {
 func (c *appRestart) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-restart",
-		Usage:   "app-restart [-a/--app appname]",
-		Desc:    `Restarts an application.`,
+		Usage:   "app-restart " + batchUsage,
+		Desc:    `Restarts an application.` + "\n\n" + fmt.Sprintf(batchDesc, "app-restart"),
 		MinArgs: 0,
 	}
 }
@@ -793,23 +1459,30 @@ func (c *SetTeamOwner) Info() *cmd.Info {
 
 type unitAdd struct {
 	cmd.GuessingCommand
+	batch appBatch
 }
 
 func (c *unitAdd) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "unit-add",
-		Usage: "unit-add <# of units> [-a/--app appname]",
+		Usage: "unit-add <# of units> " + batchUsage,
 		Desc: `Adds new units (instances) to an application. You need to have access to the
-app to be able to add new units to it.`,
+app to be able to add new units to it.
+
+` + fmt.Sprintf(batchDesc, "unit-add 2"),
 		MinArgs: 1,
 	}
 }
 
+func (c *unitAdd) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
+}
+
 func (c *unitAdd) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
+	return c.batch.run(context, client, &c.GuessingCommand, c.addUnits)
+}
+
+func (c *unitAdd) addUnits(context *cmd.Context, client *cmd.Client, appName string) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/units", appName))
 	if err != nil {
 		return err
@@ -871,3 +1544,75 @@ func (c *unitRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	fmt.Fprintln(context.Stdout, "Units successfully removed!")
 	return nil
 }
+
+type unitInfo struct {
+	cmd.GuessingCommand
+}
+
+func (c *unitInfo) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "unit-info",
+		Usage: "unit-info <unit> [-a/--app appname]",
+		Desc: `Shows the details of a unit of an application: the full record of its
+container, how long it has been in its current status and the image it runs.
+The unit may be identified by its full name or by a prefix of it, like the ones
+displayed by [[tsuru app-info]].`,
+		MinArgs: 1,
+	}
+}
+
+func (c *unitInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	a, err := getAppInfo(client, appName)
+	if err != nil {
+		return err
+	}
+	if a == nil {
+		return fmt.Errorf("app %q not found", appName)
+	}
+	name := context.Args[0]
+	var matches []unitDetail
+	for _, detail := range a.unitDetails() {
+		if detail.Name == name {
+			matches = []unitDetail{detail}
+			break
+		}
+		if strings.HasPrefix(detail.Name, name) {
+			matches = append(matches, detail)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("unit %q not found in app %q", name, appName)
+	case 1:
+		writeWarnings(context.Stderr, a.warnings)
+		writeUnitDetails(context.Stdout, matches, time.Now())
+		return nil
+	}
+	names := make([]string, len(matches))
+	for i, detail := range matches {
+		names[i] = detail.Name
+	}
+	return fmt.Errorf("unit %q is ambiguous, it matches: %s", name, strings.Join(names, ", "))
+}
+
+type appsByName []app
+
+func (l appsByName) Len() int           { return len(l) }
+func (l appsByName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l appsByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+type appsByUnits []app
+
+func (l appsByUnits) Len() int           { return len(l) }
+func (l appsByUnits) Less(i, j int) bool { return l[i].unitCount() > l[j].unitCount() }
+func (l appsByUnits) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+type appsByPlatform []app
+
+func (l appsByPlatform) Len() int           { return len(l) }
+func (l appsByPlatform) Less(i, j int) bool { return l[i].Platform < l[j].Platform }
+func (l appsByPlatform) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -7,9 +7,13 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/cmd/cmdtest"
@@ -364,6 +368,53 @@ Units: 3
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestAppInfoJSON(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	result := `{"name":"app1","teamowner":"myteam","cname":["app1.example.com"],"ip":"myapp.tsuru.io","platform":"php","repository":"git@git.com:php.git","units":[{"Ip":"10.10.10.10","Name":"app1/0","Status":"started"}],"teams":["tsuruteam"],"owner":"myapp_owner","deploys":7,"ready":true,"plan":{"name":"small","memory":1024,"swap":2048,"cpushare":100,"router":"hipache"}}`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--format", "json"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `{
+  "name": "app1",
+  "platform": "php",
+  "repository": "git@git.com:php.git",
+  "teams": [
+    "tsuruteam"
+  ],
+  "owner": "myapp_owner",
+  "team_owner": "myteam",
+  "ip": "myapp.tsuru.io",
+  "cnames": [
+    "app1.example.com"
+  ],
+  "ready": true,
+  "deploys": 7,
+  "units": [
+    {
+      "name": "app1/0",
+      "ip": "10.10.10.10",
+      "status": "started"
+    }
+  ],
+  "plan": {
+    "name": "small",
+    "memory": 1024,
+    "swap": 2048,
+    "cpushare": 100,
+    "router": "hipache",
+    "default": false
+  }
+}
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
 func (s *S) TestAppInfoNoUnits(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	result := `{"name":"app1","ip":"app1.tsuru.io","teamowner":"myteam","platform":"php","repository":"git@git.com:php.git","state":"dead","units":[],"teams":["tsuruteam","crane"], "owner": "myapp_owner", "deploys": 7}`
@@ -644,6 +695,251 @@ App Plan:
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestAppInfoTemplate(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	transport := transportFunc(func(req *http.Request) (resp *http.Response, err error) {
+		var body string
+		if req.URL.Path == "/apps/app1" {
+			body = `{"name":"app1","teamowner":"myteam","cname":["app1.example.com"],"ip":"myapp.tsuru.io","platform":"php","units":[{"Ip":"10.10.10.10","Name":"app1/0","Status":"started"}, {"Ip":"9.9.9.9","Name":"app1/1","Status":"started"}, {"Ip":"","Name":"app1/2","Status":"pending"}],"plan":{"name": "test", "memory": 536870912, "swap": 268435456, "cpushare": 100, "router": "freeeee"}}`
+		} else if req.URL.Path == "/docker/node/apps/app1/containers" {
+			body = `[{"ID":"app1/0","HostAddr":"10.0.0.1","HostPort":"4001","Image":"tsuru/app-app1:v3"}]`
+		} else if req.URL.Path == "/services/instances" && req.URL.RawQuery == "app=app1" {
+			body = `[{"service":"redisapi","instances":["myredisapi"]}]`
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	tmpl := `{{.Addr}} {{len (.UnitsWithStatus "started")}}/{{len .Units}} {{.Plan.Router}}` +
+		`{{range .Containers}} {{.HostAddr}}:{{.HostPort}} {{.Image}}{{end}}` +
+		`{{range .Services}} {{.Service}}={{index .Instances 0}}{{end}}`
+	command.Flags().Parse(true, []string{"--app", "app1", "--template", tmpl})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := "app1.example.com, myapp.tsuru.io 2/3 freeeee 10.0.0.1:4001 tsuru/app-app1:v3 redisapi=myredisapi\n"
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppInfoTemplateInvalid(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	result := `{"name":"app1","ip":"myapp.tsuru.io","platform":"php"}`
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--template", "{{.Name"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.NotNil)
+	c.Assert(stdout.String(), check.Equals, "")
+}
+
+func unitDetailsTransport(lastUpdate time.Time) http.RoundTripper {
+	return transportFunc(func(req *http.Request) (resp *http.Response, err error) {
+		var body string
+		switch req.URL.Path {
+		case "/apps/app1":
+			body = `{"name":"app1","platform":"python","units":[{"Ip":"10.10.10.10","Name":"9930c24f1c4f","Status":"started"},{"Ip":"10.10.10.11","Name":"9930c24f1c5f","Status":"started"},{"Ip":"10.10.10.12","Name":"1ab2c3d4e5f6","Status":"building"}]}`
+		case "/docker/node/apps/app1/containers":
+			update := lastUpdate.Format(time.RFC3339)
+			body = `[{"ID":"9930c24f1c4f9f","Type":"python","IP":"10.10.10.10","HostAddr":"10.0.0.1","HostPort":"49153","SSHHostPort":"49154","Status":"started","Version":"3","Image":"tsuru/app-app1:v4","LastStatusUpdate":"` + update + `"},` +
+				`{"ID":"9930c24f1c5f7a","Type":"python","IP":"10.10.10.11","HostAddr":"10.0.0.2","HostPort":"49155","SSHHostPort":"49156","Status":"started","Version":"2","Image":"tsuru/app-app1:v3"}]`
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+}
+
+func (s *S) TestAppInfoUnits(c *check.C) {
+	lastUpdate := time.Now().Add(-(2*time.Hour + 3*time.Minute + 30*time.Second)).Truncate(time.Second)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: unitDetailsTransport(lastUpdate)}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--units"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Unit: 9930c24f1c4f
+Status: started (for 2h 3m, since ` + lastUpdate.Local().Format(time.Stamp) + `)
+Image: tsuru/app-app1:v4
+Version: 3
+Type: python
+Container: 9930c24f1c4f9f
+IP: 10.10.10.10
+Host: 10.0.0.1:49153
+SSH host port: 49154
+
+Unit: 9930c24f1c5f
+Status: started
+Image: tsuru/app-app1:v3 ` + cmd.Colorfy("(outdated, the newest image is tsuru/app-app1:v4)", "red", "", "") + `
+Version: 2
+Type: python
+Container: 9930c24f1c5f7a
+IP: 10.10.10.11
+Host: 10.0.0.2:49155
+SSH host port: 49156
+
+Unit: 1ab2c3d4e5f6
+Status: building
+IP: 10.10.10.12
+Container: not available
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppInfoUnitsWithFormat(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--units", "--format", "json"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "--units can't be used with --watch, --format or --template")
+}
+
+func (s *S) TestAppInfoRequestsAreConcurrent(c *check.C) {
+	var mu sync.Mutex
+	var inFlight int
+	allInFlight := make(chan struct{})
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		inFlight++
+		if inFlight == 3 {
+			close(allInFlight)
+		}
+		mu.Unlock()
+		select {
+		case <-allInFlight:
+		case <-time.After(2 * time.Second):
+			return nil, errors.New("requests were not concurrent")
+		}
+		var body string
+		switch req.URL.Path {
+		case "/apps/app1":
+			body = `{"name":"app1","platform":"php","ip":"app1.tsuru.io","units":[]}`
+		case "/docker/node/apps/app1/containers":
+			body = `[]`
+		case "/services/instances":
+			body = `[{"service":"redisapi","instances":["myredisapi"]}]`
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--template", "{{.Name}} {{range .Services}}{{.Service}}{{end}}"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "app1 redisapi\n")
+	c.Assert(stderr.String(), check.Equals, "")
+}
+
+func (s *S) TestAppInfoWarnings(c *check.C) {
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		switch req.URL.Path {
+		case "/docker/node/apps/app1/containers":
+			return &http.Response{
+				Body:       ioutil.NopCloser(bytes.NewBufferString("You don't have permission to do this action\n")),
+				StatusCode: http.StatusForbidden,
+			}, nil
+		case "/services/instances":
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"name":"app1","platform":"php","ip":"app1.tsuru.io"}`)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--template", "{{.Name}}"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "app1\n")
+	warning := cmd.Colorfy("Warning:", "yellow", "", "bold")
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	c.Assert(lines[0], check.Equals, warning+" could not load the containers of the app: permission denied (You don't have permission to do this action)")
+	c.Assert(lines[1], check.Matches, regexp.QuoteMeta(warning)+` could not load the service instances of the app: network failure \(.*connection refused\)`)
+}
+
+func (s *S) TestAppInfoTimeout(c *check.C) {
+	oldTimeout := appInfoTimeout
+	appInfoTimeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer func() {
+		appInfoTimeout = oldTimeout
+		close(release)
+	}()
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		body := `{"name":"app1","platform":"php","ip":"app1.tsuru.io"}`
+		switch req.URL.Path {
+		case "/docker/node/apps/app1/containers":
+			<-release
+		case "/services/instances":
+			body = `[]`
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString(body)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1", "--template", "{{.Name}}"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "app1\n")
+	warning := cmd.Colorfy("Warning:", "yellow", "", "bold")
+	c.Assert(stderr.String(), check.Equals, warning+" could not load the containers of the app: timed out after 50ms\n")
+}
+
+func (s *S) TestAppInfoTimeoutLoadingApp(c *check.C) {
+	oldTimeout := appInfoTimeout
+	appInfoTimeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer func() {
+		appInfoTimeout = oldTimeout
+		close(release)
+	}()
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/apps/app1" {
+			<-release
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(bytes.NewBufferString("[]")),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	context := cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "timed out after 50ms")
+}
+
 func (s *S) TestAppInfoInfo(c *check.C) {
 	c.Assert((&appInfo{}).Info(), check.NotNil)
 }
@@ -751,6 +1047,22 @@ func (s *S) TestAppList(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestAppListTemplate(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"ip":"10.10.10.11","name":"sapp","ready":true,"units":[{"Name":"sapp1/0","Status":"started"}]},{"ip":"10.10.10.10","name":"app1","ready":false,"units":[]}]`
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := appList{}
+	command.Flags().Parse(true, []string{"--template", "{{.Name}} {{.Ip}} {{len .Units}}"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "app1 10.10.10.10 0\nsapp 10.10.10.11 1\n")
+}
+
 func (s *S) TestAppListDisplayAppsInAlphabeticalOrder(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	result := `[{"ip":"10.10.10.11","name":"sapp","ready":true,"units":[{"Name":"sapp1/0","Status":"started"}]},{"ip":"10.10.10.10","name":"app1","ready":true,"units":[{"Name":"app1/0","Status":"started"}]}]`
@@ -880,6 +1192,104 @@ func (s *S) TestAppListCName(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+const appListFilterResult = `[
+{"name":"web","platform":"python","owner":"alice@example.com","teamowner":"frontend","teams":["frontend","ops"],"ready":true,"plan":{"name":"large"},"units":[{"Name":"web/0","Status":"started"},{"Name":"web/1","Status":"started"},{"Name":"web/2","Status":"error"}]},
+{"name":"api","platform":"go","owner":"bob@example.com","teamowner":"backend","teams":["backend"],"ready":true,"plan":{"name":"small"},"units":[{"Name":"api/0","Status":"started"},{"Name":"api/1","Status":"unreachable"}]},
+{"name":"worker","platform":"python","owner":"bob@example.com","teamowner":"backend","teams":["backend","ops"],"ready":false,"plan":{"name":"small"},"units":[{"Name":"","Status":""}]},
+{"name":"web-admin","platform":"ruby","owner":"alice@example.com","teamowner":"frontend","teams":["frontend"],"ready":true,"plan":{"name":"small"},"units":[{"Name":"web-admin/0","Status":"started"}]}
+]`
+
+func runAppList(c *check.C, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: appListFilterResult, Status: http.StatusOK}}, nil, manager)
+	command := appList{}
+	err := command.Flags().Parse(true, args)
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	return stdout.String(), err
+}
+
+func (s *S) TestAppListQuiet(c *check.C) {
+	out, err := runAppList(c, "-q")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "api\nweb\nweb-admin\nworker\n")
+}
+
+func (s *S) TestAppListFilters(c *check.C) {
+	var tests = []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--team", "ops"}, "web\nworker\n"},
+		{[]string{"--team", "backend"}, "api\nworker\n"},
+		{[]string{"--owner", "alice@example.com"}, "web\nweb-admin\n"},
+		{[]string{"--platform", "python"}, "web\nworker\n"},
+		{[]string{"--plan", "small"}, "api\nweb-admin\nworker\n"},
+		{[]string{"--name", "^web"}, "web\nweb-admin\n"},
+		{[]string{"--name", "er$"}, "worker\n"},
+		{[]string{"--ready"}, "api\nweb\nweb-admin\n"},
+		{[]string{"--not-ready"}, "worker\n"},
+		{[]string{"--unhealthy"}, "web\n"},
+		{[]string{"--owner", "bob@example.com", "--platform", "python"}, "worker\n"},
+		{[]string{"--team", "nobody"}, ""},
+	}
+	for _, t := range tests {
+		out, err := runAppList(c, append(t.args, "-q")...)
+		c.Check(err, check.IsNil)
+		c.Check(out, check.Equals, t.expected, check.Commentf("args: %v", t.args))
+	}
+}
+
+func (s *S) TestAppListSortBy(c *check.C) {
+	out, err := runAppList(c, "-q", "--sort-by", "units")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "web\napi\nweb-admin\nworker\n")
+	out, err = runAppList(c, "-q", "--sort-by", "platform")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "api\nweb\nworker\nweb-admin\n")
+}
+
+func (s *S) TestAppListSortByTable(c *check.C) {
+	out, err := runAppList(c, "--platform", "python", "--sort-by", "units")
+	c.Assert(err, check.IsNil)
+	expected := `+-------------+-------------------------+---------+--------+
+| Application | Units State Summary     | Address | Ready? |
++-------------+-------------------------+---------+--------+
+| web         | 2 of 3 units in-service |         | Yes    |
++-------------+-------------------------+---------+--------+
+| worker      | 0 of 0 units in-service |         | No     |
++-------------+-------------------------+---------+--------+
+`
+	c.Assert(out, check.Equals, expected)
+}
+
+func (s *S) TestAppListFilterAndFormat(c *check.C) {
+	out, err := runAppList(c, "--unhealthy", "--template", "{{.Name}} {{len (.UnitsWithStatus \"error\")}}")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "web 1\n")
+}
+
+func (s *S) TestAppListInvalidFlags(c *check.C) {
+	var tests = []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--ready", "--not-ready"}, "please use only one of --ready and --not-ready"},
+		{[]string{"--name", "web("}, "invalid regular expression in --name: error parsing regexp: missing closing ): `web(`"},
+		{[]string{"--sort-by", "owner"}, `invalid value for --sort-by: "owner", use name, units or platform`},
+		{[]string{"-q", "--format", "json"}, "please use only one of --quiet and --format/--template"},
+	}
+	for _, t := range tests {
+		_, err := runAppList(c, t.args...)
+		c.Check(err, check.ErrorMatches, regexp.QuoteMeta(t.expected), check.Commentf("args: %v", t.args))
+	}
+}
+
 func (s *S) TestAppListInfo(c *check.C) {
 	c.Assert(appList{}.Info(), check.NotNil)
 }
@@ -1363,3 +1773,88 @@ func (s *S) TestUnitRemoveInfo(c *check.C) {
 func (s *S) TestUnitRemoveIsACommand(c *check.C) {
 	var _ cmd.Command = &unitRemove{}
 }
+
+func (s *S) TestUnitInfoInfo(c *check.C) {
+	c.Assert((&unitInfo{}).Info(), check.NotNil)
+}
+
+func (s *S) TestUnitInfoIsACommand(c *check.C) {
+	var _ cmd.Command = &unitInfo{}
+}
+
+func (s *S) TestAppUnitDetailsMatching(c *check.C) {
+	a := app{
+		Units: []unit{{Name: "9930c24f1c4f"}, {Name: "9930"}, {Name: "app1/0"}},
+		containers: []container{
+			{ID: ""},
+			{ID: "9930c24f1c"},
+			{ID: "9930c24f1c4f9f"},
+			{ID: "app1/0"},
+		},
+	}
+	details := a.unitDetails()
+	c.Assert(details, check.HasLen, 3)
+	c.Assert(details[0].container, check.NotNil)
+	c.Assert(details[0].container.ID, check.Equals, "9930c24f1c4f9f")
+	c.Assert(details[1].container, check.IsNil)
+	c.Assert(details[2].container, check.NotNil)
+	c.Assert(details[2].container.ID, check.Equals, "app1/0")
+}
+
+func (s *S) TestUnitInfo(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"9930c24f1c5f"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: unitDetailsTransport(time.Now())}, nil, manager)
+	command := unitInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, "(?s)Unit: 9930c24f1c5f\nStatus: started\nImage: tsuru/app-app1:v3 .*outdated.*SSH host port: 49156\n")
+}
+
+func (s *S) TestUnitInfoPrefix(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"1ab"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: unitDetailsTransport(time.Now())}, nil, manager)
+	command := unitInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Unit: 1ab2c3d4e5f6\nStatus: building\nIP: 10.10.10.12\nContainer: not available\n")
+}
+
+func (s *S) TestUnitInfoNotFoundOrAmbiguous(c *check.C) {
+	client := cmd.NewClient(&http.Client{Transport: unitDetailsTransport(time.Now())}, nil, manager)
+	command := unitInfo{}
+	command.Flags().Parse(true, []string{"--app", "app1"})
+	context := cmd.Context{Args: []string{"ffff"}, Stdout: ioutil.Discard}
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `unit "ffff" not found in app "app1"`)
+	context.Args = []string{"9930"}
+	err = command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `unit "9930" is ambiguous, it matches: 9930c24f1c4f, 9930c24f1c5f`)
+}
+
+func (s *S) TestFormatAge(c *check.C) {
+	c.Assert(formatAge(-time.Second), check.Equals, "0s")
+	c.Assert(formatAge(42*time.Second), check.Equals, "42s")
+	c.Assert(formatAge(5*time.Minute+12*time.Second), check.Equals, "5m 12s")
+	c.Assert(formatAge(2*time.Hour+5*time.Minute+3*time.Second), check.Equals, "2h 5m")
+	c.Assert(formatAge(74*time.Hour), check.Equals, "3d 2h")
+}
+
+func (s *S) TestImageVersion(c *check.C) {
+	version, ok := imageVersion("registry.example.com/tsuru/app-myapp:v12")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(version, check.Equals, 12)
+	_, ok = imageVersion("registry.example.com/myapp:latest")
+	c.Assert(ok, check.Equals, false)
+}
@@ -238,9 +238,26 @@ func (c *teamUserRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
-type teamUserList struct{}
+type teamUserList struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *teamUserList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("team-user-list", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
+
+// teamUserView is the representation of a team member in the json, yaml and
+// template output formats.
+type teamUserView struct {
+	Email string `json:"email" yaml:"email"`
+}
 
-func (teamUserList) Run(context *cmd.Context, client *cmd.Client) error {
+func (c teamUserList) Run(context *cmd.Context, client *cmd.Client) error {
 	teamName := context.Args[0]
 	url, err := cmd.GetURL("/teams/" + teamName)
 	if err != nil {
@@ -261,28 +278,57 @@ func (teamUserList) Run(context *cmd.Context, client *cmd.Client) error {
 		return err
 	}
 	sort.Strings(t.Users)
-	for _, user := range t.Users {
-		fmt.Fprintf(context.Stdout, "- %s\n", user)
+	views := make([]teamUserView, len(t.Users))
+	for i, user := range t.Users {
+		views[i] = teamUserView{Email: user}
 	}
-	return nil
+	return c.output.render(context.Stdout, views, func() error {
+		for _, user := range t.Users {
+			fmt.Fprintf(context.Stdout, "- %s\n", user)
+		}
+		return nil
+	})
 }
 
 func (teamUserList) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "team-user-list",
-		Usage:   "team-user-list <teamname>",
-		Desc:    "List members of a team.",
+		Name:  "team-user-list",
+		Usage: "team-user-list <teamname> [--format table|json|yaml|template] [--template <template>]",
+		Desc: `List members of a team.
+
+The [[--format]] flag prints the members in the json, yaml or template
+formats, with the field: email.`,
 		MinArgs: 1,
 	}
 }
 
-type teamList struct{}
+type teamList struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *teamList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("team-list", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
+
+// teamView is the representation of a team in the json, yaml and template
+// output formats.
+type teamView struct {
+	Name string `json:"name" yaml:"name"`
+}
 
 func (c *teamList) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "team-list",
-		Usage:   "team-list",
-		Desc:    "List all teams that you are member.",
+		Name:  "team-list",
+		Usage: "team-list [--format table|json|yaml|template] [--template <template>]",
+		Desc: `List all teams that you are member.
+
+The [[--format]] flag prints the teams in the json, yaml or template formats,
+with the field: name.`,
 		MinArgs: 0,
 	}
 }
@@ -300,6 +346,7 @@ func (c *teamList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
+	views := []teamView{}
 	if resp.StatusCode == http.StatusOK {
 		defer resp.Body.Close()
 		b, err := ioutil.ReadAll(resp.Body)
@@ -311,12 +358,20 @@ func (c *teamList) Run(context *cmd.Context, client *cmd.Client) error {
 		if err != nil {
 			return err
 		}
-		io.WriteString(context.Stdout, "Teams:\n\n")
 		for _, team := range teams {
-			fmt.Fprintf(context.Stdout, "  - %s\n", team["name"])
+			views = append(views, teamView{Name: team["name"]})
 		}
 	}
-	return nil
+	return c.output.render(context.Stdout, views, func() error {
+		if resp.StatusCode != http.StatusOK {
+			return nil
+		}
+		io.WriteString(context.Stdout, "Teams:\n\n")
+		for _, team := range views {
+			fmt.Fprintf(context.Stdout, "  - %s\n", team.Name)
+		}
+		return nil
+	})
 }
 
 type changePassword struct{}
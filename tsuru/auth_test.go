@@ -164,6 +164,21 @@ func (s *S) TestTeamUserList(c *check.C) {
 	c.Assert(buf.String(), check.Equals, expected)
 }
 
+func (s *S) TestTeamUserListFormatTemplate(c *check.C) {
+	var buf bytes.Buffer
+	context := cmd.Context{Args: []string{"symfonia"}, Stdout: &buf}
+	transport := cmdtest.Transport{
+		Status:  http.StatusOK,
+		Message: `{"name":"symfonia","users":["somebody@tsuru.io","me@tsuru.io"]}`,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	command := teamUserList{}
+	command.Flags().Parse(true, []string{"--format", "template", "--template", "<{{.Email}}>"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "<me@tsuru.io>\n<somebody@tsuru.io>\n")
+}
+
 func (s *S) TestTeamUserListError(c *check.C) {
 	var buf bytes.Buffer
 	context := cmd.Context{Args: []string{"symfonia"}, Stdout: &buf}
@@ -223,6 +238,27 @@ func (s *S) TestTeamListRunWithNoContent(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, "")
 }
 
+func (s *S) TestTeamListFormatYAML(c *check.C) {
+	trans := &cmdtest.Transport{Message: `[{"name":"timeredbull"},{"name":"cobrateam"}]`, Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	command := teamList{}
+	command.Flags().Parse(true, []string{"--format", "yaml"})
+	err := command.Run(&cmd.Context{Stdout: &stdout, Stderr: &stderr}, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "- name: timeredbull\n- name: cobrateam\n")
+}
+
+func (s *S) TestTeamListFormatJSONWithNoContent(c *check.C) {
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: "", Status: http.StatusNoContent}}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	command := teamList{}
+	command.Flags().Parse(true, []string{"--format", "json"})
+	err := command.Run(&cmd.Context{Stdout: &stdout, Stderr: &stderr}, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "[]\n")
+}
+
 func (s *S) TestTeamListInfo(c *check.C) {
 	c.Assert((&teamList{}).Info(), check.NotNil)
 }
@@ -0,0 +1,278 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/tsuru/tsuru/cmd"
+	"launchpad.net/gnuflag"
+)
+
+// defaultBatchParallel is the number of apps handled at the same time by
+// the commands that run on multiple apps.
+const defaultBatchParallel = 4
+
+const batchUsage = "[-a/--app appname]... [--apps-from-file <file>] [--selector <selector>] [--parallel <n>]"
+
+const batchDesc = `The command may run on multiple apps at once: [[-a/--app]] may be repeated,
+[[--apps-from-file]] reads the names of the apps from a file, one per line,
+and [[--selector]] runs the command on the apps matching all the given
+key=value pairs, separated by commas. The keys are team, owner, platform,
+plan and name, a regular expression matched against the name of the app.
+For example::
+
+    $ tsuru %s --selector team=myteam,platform=python
+
+The apps are handled in parallel, up to the number given in [[--parallel]]
+(4 by default), with each line of output prefixed by the name of the app. A
+summary is displayed at the end, and the command fails if it fails for any
+of the apps.`
+
+// appsFlag is the value of the -a/--app flag of the commands that accept
+// multiple apps, holding the name given in each occurrence of the flag.
+type appsFlag []string
+
+func (f *appsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *appsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// appBatch holds the flags of the commands that may run on multiple apps,
+// and runs them on each of the selected apps.
+type appBatch struct {
+	apps     appsFlag
+	appsFile string
+	selector string
+	parallel int
+	fs       *gnuflag.FlagSet
+}
+
+func (b *appBatch) flags() *gnuflag.FlagSet {
+	if b.fs == nil {
+		b.fs = gnuflag.NewFlagSet("", gnuflag.ExitOnError)
+		b.fs.Var(&b.apps, "app", "The name of the app (may be repeated)")
+		b.fs.Var(&b.apps, "a", "The name of the app (may be repeated)")
+		b.fs.StringVar(&b.appsFile, "apps-from-file", "", "File with the names of the apps, one per line")
+		b.fs.StringVar(&b.selector, "selector", "", "Run on the apps matching the selector, as in team=myteam,platform=python")
+		b.fs.IntVar(&b.parallel, "parallel", defaultBatchParallel, "Number of apps handled at the same time")
+	}
+	return b.fs
+}
+
+// run calls fn for each of the selected apps. When a single app is given in
+// -a/--app, or guessed, fn is called with the original context, so the output
+// is the same as before batch operations existed.
+func (b *appBatch) run(context *cmd.Context, client *cmd.Client, g *cmd.GuessingCommand, fn func(*cmd.Context, *cmd.Client, string) error) error {
+	if b.appsFile == "" && b.selector == "" && len(b.apps) < 2 {
+		appName := ""
+		if len(b.apps) == 1 {
+			appName = b.apps[0]
+		} else {
+			var err error
+			appName, err = g.Guess()
+			if err != nil {
+				return err
+			}
+		}
+		return fn(context, client, appName)
+	}
+	if b.parallel < 1 {
+		return errors.New("the value of --parallel must be at least 1")
+	}
+	appNames, err := b.appNames(client)
+	if err != nil {
+		return err
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	errs := make([]error, len(appNames))
+	sem := make(chan struct{}, b.parallel)
+	for i, appName := range appNames {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, appName string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			stdout := &prefixWriter{mu: &mu, w: context.Stdout, prefix: appName + ": "}
+			stderr := &prefixWriter{mu: &mu, w: context.Stderr, prefix: appName + ": "}
+			ctx := cmd.Context{
+				Args:   context.Args,
+				Stdout: stdout,
+				Stderr: stderr,
+				Stdin:  context.Stdin,
+			}
+			errs[i] = fn(&ctx, client, appName)
+			stdout.flush()
+			stderr.flush()
+		}(i, appName)
+	}
+	wg.Wait()
+	var failed int
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	fmt.Fprintf(context.Stdout, "\nSummary: %d of %d apps succeeded\n", len(appNames)-failed, len(appNames))
+	for i, appName := range appNames {
+		if errs[i] != nil {
+			fmt.Fprintf(context.Stdout, "  %s: %s %s\n", appName, cmd.Colorfy("failed:", "red", "", "bold"), errs[i])
+		} else {
+			fmt.Fprintf(context.Stdout, "  %s: ok\n", appName)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("the command failed for %d of %d apps", failed, len(appNames))
+	}
+	return nil
+}
+
+// appNames returns the apps selected by -a/--app, --apps-from-file and
+// --selector, without repetitions.
+func (b *appBatch) appNames(client *cmd.Client) ([]string, error) {
+	names := append([]string(nil), b.apps...)
+	if b.appsFile != "" {
+		fromFile, err := readAppNames(b.appsFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(fromFile) == 0 {
+			return nil, fmt.Errorf("no apps found in %s", b.appsFile)
+		}
+		names = append(names, fromFile...)
+	}
+	if b.selector != "" {
+		filter, err := parseSelector(b.selector)
+		if err != nil {
+			return nil, err
+		}
+		apps, err := (&appList{filter: filter}).fetch(client)
+		if err != nil {
+			return nil, err
+		}
+		if len(apps) == 0 {
+			return nil, fmt.Errorf("no apps match the selector %q", b.selector)
+		}
+		for _, a := range apps {
+			names = append(names, a.Name)
+		}
+	}
+	var unique []string
+	for _, name := range names {
+		if !containsString(unique, name) {
+			unique = append(unique, name)
+		}
+	}
+	return unique, nil
+}
+
+// readAppNames reads the names of the apps from the file, one per line,
+// ignoring blank lines and comments started by #.
+func readAppNames(path string) ([]string, error) {
+	f, err := filesystem().Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			names = append(names, line)
+		}
+	}
+	return names, scanner.Err()
+}
+
+// parseSelector parses a selector in the form key=value[,key=value...] into
+// the filter used by app-list.
+func parseSelector(selector string) (appFilter, error) {
+	var filter appFilter
+	invalid := fmt.Errorf("invalid selector %q, use key=value pairs separated by commas, with the keys team, owner, platform, plan or name", selector)
+	for _, pair := range strings.Split(selector, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return appFilter{}, invalid
+		}
+		switch value := parts[1]; parts[0] {
+		case "team":
+			filter.team = value
+		case "owner":
+			filter.owner = value
+		case "platform":
+			filter.platform = value
+		case "plan":
+			filter.plan = value
+		case "name":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return appFilter{}, fmt.Errorf("invalid regular expression in the selector: %s", err)
+			}
+			filter.name = re
+		default:
+			return appFilter{}, invalid
+		}
+	}
+	return filter, nil
+}
+
+// prefixWriter writes each line to w prefixed by the name of the app, so
+// the output of apps handled at the same time doesn't get mixed. Writers
+// sharing the same underlying writer must share the mutex too.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		err := p.writeLine(p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+		if err != nil {
+			return len(b), err
+		}
+	}
+	return len(b), nil
+}
+
+// flush writes the last line, when it doesn't end with a newline.
+func (p *prefixWriter) flush() error {
+	if len(p.buf) == 0 {
+		return nil
+	}
+	line := append(p.buf, '\n')
+	p.buf = nil
+	return p.writeLine(line)
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, err := fmt.Fprintf(p.w, "%s%s", p.prefix, line)
+	return err
+}
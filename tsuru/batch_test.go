@@ -0,0 +1,206 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+// batchTransport answers the actions of the batch tests with a message that
+// includes the app name, failing for the apps in failures.
+func batchTransport(failures ...string) (*[]string, http.RoundTripper) {
+	var mu sync.Mutex
+	var requests []string
+	return &requests, transportFunc(func(req *http.Request) (*http.Response, error) {
+		body, status := `[{"name":"app1","teamowner":"myteam"},{"name":"app2","teams":["myteam"]},{"name":"app3","teamowner":"other"}]`, http.StatusOK
+		if req.URL.Path != "/apps" {
+			appName := strings.Split(req.URL.Path, "/")[2]
+			mu.Lock()
+			requests = append(requests, req.Method+" "+req.URL.Path)
+			mu.Unlock()
+			body = `{"Message":"done with ` + appName + `\nbye"}`
+			if containsString(failures, appName) {
+				body, status = "something went wrong", http.StatusInternalServerError
+			}
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			StatusCode: status,
+		}, nil
+	})
+}
+
+func runBatch(command cmd.FlaggedCommand, transport http.RoundTripper, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	err := command.Flags().Parse(true, args)
+	if err != nil {
+		return "", "", err
+	}
+	context := cmd.Context{
+		Args:   command.Flags().Args(),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	err = command.Run(&context, client)
+	return stdout.String(), stderr.String(), err
+}
+
+func (s *S) TestAppsFlag(c *check.C) {
+	var batch appBatch
+	err := batch.flags().Parse(true, []string{"-a", "app1", "--app", "app2", "-a", "app3"})
+	c.Assert(err, check.IsNil)
+	c.Assert([]string(batch.apps), check.DeepEquals, []string{"app1", "app2", "app3"})
+	c.Assert(batch.apps.String(), check.Equals, "app1,app2,app3")
+	c.Assert(batch.parallel, check.Equals, defaultBatchParallel)
+}
+
+func (s *S) TestAppRestartMultipleApps(c *check.C) {
+	requests, transport := batchTransport("app2")
+	out, _, err := runBatch(&appRestart{}, transport, "-a", "app1", "-a", "app2", "-a", "app3")
+	c.Assert(err, check.ErrorMatches, "the command failed for 1 of 3 apps")
+	c.Assert(*requests, check.HasLen, 3)
+	lines := strings.Split(out, "\n")
+	c.Assert(containsString(lines, "app1: done with app1"), check.Equals, true)
+	c.Assert(containsString(lines, "app1: bye"), check.Equals, true)
+	c.Assert(containsString(lines, "app3: done with app3"), check.Equals, true)
+	c.Assert(containsString(lines, "app3: bye"), check.Equals, true)
+	c.Assert(strings.HasSuffix(out, `
+Summary: 2 of 3 apps succeeded
+  app1: ok
+  app2: `+cmd.Colorfy("failed:", "red", "", "bold")+` something went wrong
+  app3: ok
+`), check.Equals, true)
+}
+
+func (s *S) TestAppStopSelector(c *check.C) {
+	requests, transport := batchTransport()
+	out, _, err := runBatch(&appStop{}, transport, "--selector", "team=myteam", "--parallel", "1")
+	c.Assert(err, check.IsNil)
+	c.Assert(*requests, check.DeepEquals, []string{"POST /apps/app1/stop", "POST /apps/app2/stop"})
+	c.Assert(strings.HasSuffix(out, "\nSummary: 2 of 2 apps succeeded\n  app1: ok\n  app2: ok\n"), check.Equals, true)
+}
+
+func (s *S) TestAppStartAppsFromFile(c *check.C) {
+	rfs := &fstest.RecordingFs{FileContent: "# staging apps\napp3\n\napp1 # the main one\napp3\n"}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	requests, transport := batchTransport()
+	_, _, err := runBatch(&appStart{}, transport, "--apps-from-file", "apps.txt", "-a", "app1", "--parallel", "1")
+	c.Assert(err, check.IsNil)
+	c.Assert(rfs.HasAction("open apps.txt"), check.Equals, true)
+	c.Assert(*requests, check.DeepEquals, []string{"POST /apps/app1/start", "POST /apps/app3/start"})
+}
+
+func (s *S) TestEnvSetMultipleApps(c *check.C) {
+	var mu sync.Mutex
+	bodies := map[string]string{}
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		b, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		bodies[req.Method+" "+req.URL.Path] = strings.TrimSpace(string(b))
+		mu.Unlock()
+		return &http.Response{Body: ioutil.NopCloser(strings.NewReader("")), StatusCode: http.StatusOK}, nil
+	})
+	_, _, err := runBatch(&envSet{}, transport, "-a", "app1", "-a", "app2", "DEBUG=false")
+	c.Assert(err, check.IsNil)
+	c.Assert(bodies, check.DeepEquals, map[string]string{
+		"POST /apps/app1/env": `{"DEBUG":"false"}`,
+		"POST /apps/app2/env": `{"DEBUG":"false"}`,
+	})
+	_, _, err = runBatch(&envSet{}, transport, "-a", "app1", "-a", "app2", "DEBUG")
+	c.Assert(err, check.ErrorMatches, envSetValidationMessage)
+}
+
+func (s *S) TestEnvUnsetAndUnitAddMultipleApps(c *check.C) {
+	requests, transport := batchTransport()
+	_, _, err := runBatch(&envUnset{}, transport, "-a", "app1", "-a", "app2", "--parallel", "1", "DEBUG")
+	c.Assert(err, check.IsNil)
+	_, _, err = runBatch(&unitAdd{}, transport, "-a", "app1", "-a", "app2", "--parallel", "1", "2")
+	c.Assert(err, check.IsNil)
+	c.Assert(*requests, check.DeepEquals, []string{
+		"DELETE /apps/app1/env", "DELETE /apps/app2/env",
+		"PUT /apps/app1/units", "PUT /apps/app2/units",
+	})
+}
+
+func (s *S) TestBatchParallelLimit(c *check.C) {
+	var mu sync.Mutex
+	var running, max int
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		running++
+		if running > max {
+			max = running
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return &http.Response{Body: ioutil.NopCloser(strings.NewReader("")), StatusCode: http.StatusOK}, nil
+	})
+	args := []string{"--parallel", "2"}
+	for _, name := range []string{"app1", "app2", "app3", "app4", "app5"} {
+		args = append(args, "-a", name)
+	}
+	out, _, err := runBatch(&appStop{}, transport, args...)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(out, "Summary: 5 of 5 apps succeeded"), check.Equals, true)
+	c.Assert(max > 0 && max <= 2, check.Equals, true)
+	_, _, err = runBatch(&appStop{}, transport, "-a", "app1", "-a", "app2", "--parallel", "0")
+	c.Assert(err, check.ErrorMatches, "the value of --parallel must be at least 1")
+}
+
+func (s *S) TestBatchNoAppsSelected(c *check.C) {
+	_, transport := batchTransport()
+	_, _, err := runBatch(&appStop{}, transport, "--selector", "team=nobody")
+	c.Assert(err, check.ErrorMatches, `no apps match the selector "team=nobody"`)
+	fsystem = &fstest.RecordingFs{FileContent: "# nothing here\n"}
+	defer func() {
+		fsystem = nil
+	}()
+	_, _, err = runBatch(&appStop{}, transport, "--apps-from-file", "apps.txt")
+	c.Assert(err, check.ErrorMatches, "no apps found in apps.txt")
+}
+
+func (s *S) TestParseSelector(c *check.C) {
+	filter, err := parseSelector("team=myteam, platform=python,name=^web-")
+	c.Assert(err, check.IsNil)
+	c.Assert(filter.team, check.Equals, "myteam")
+	c.Assert(filter.platform, check.Equals, "python")
+	c.Assert(filter.name.String(), check.Equals, "^web-")
+	filter, err = parseSelector("owner=me@example.com,plan=small")
+	c.Assert(err, check.IsNil)
+	c.Assert(filter.owner, check.Equals, "me@example.com")
+	c.Assert(filter.plan, check.Equals, "small")
+	for _, selector := range []string{"myteam", "team=", "pool=default"} {
+		_, err = parseSelector(selector)
+		c.Check(err, check.ErrorMatches, `invalid selector ".*", use key=value pairs separated by commas, with the keys team, owner, platform, plan or name`)
+	}
+	_, err = parseSelector("name=(")
+	c.Assert(err, check.ErrorMatches, "invalid regular expression in the selector: .*")
+}
+
+func (s *S) TestPrefixWriter(c *check.C) {
+	var buf bytes.Buffer
+	w := prefixWriter{mu: &sync.Mutex{}, w: &buf, prefix: "app1: "}
+	w.Write([]byte("first li"))
+	w.Write([]byte("ne\nsecond line\nthird"))
+	c.Assert(buf.String(), check.Equals, "app1: first line\napp1: second line\n")
+	w.flush()
+	c.Assert(buf.String(), check.Equals, "app1: first line\napp1: second line\napp1: third\n")
+}
@@ -0,0 +1,443 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"launchpad.net/gnuflag"
+)
+
+// targetTokenEnv is the environment variable with the token used by
+// app-clone in the requests to the target given in --target.
+const targetTokenEnv = "TSURU_TARGET_TOKEN"
+
+type appClone struct {
+	target       string
+	image        string
+	withServices bool
+	fs           *gnuflag.FlagSet
+}
+
+func (c *appClone) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-clone",
+		Usage: "app-clone <source-app> <destination-app> [--target <name>] [--image <image>] [--with-services]",
+		Desc: `Creates a copy of an app, with the same platform, plan and team owner, and
+deploys the image currently running in the source app to the copy.
+
+The teams with access to the app, the public environment variables and the
+number of units are copied too. The cnames are not, so the copy is only
+reachable by its own address. Private environment variables can't be read,
+so they're listed at the end and must be set with [[tsuru env-set]].
+
+The copy isn't bound to the service instances of the source app. With
+[[--with-services]], a new instance of each service, with the same plan, is
+created and bound to the copy.
+
+The [[--target]] flag creates the copy in another tsuru server, given by its
+name in [[tsuru target-list]] or by its address. The credentials of the
+current target are never sent to the other server: the requests to it are
+made with the token in the TSURU_TARGET_TOKEN environment variable, which
+must be set. As the image of the source app is stored in the registry of the
+current target, the other server can't be assumed to pull it, so the image
+deployed to the copy must be given in [[--image]], after being pushed to a
+registry the other server can pull from.
+
+When a step fails, everything created by the command is removed. For
+example, to create a staging copy of an app with new service instances::
+
+    $ tsuru app-clone myapp myapp-staging --with-services`,
+		MinArgs: 2,
+		MaxArgs: 2,
+	}
+}
+
+func (c *appClone) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-clone", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.target, "target", "", "Name or address of the tsuru server where the copy is created")
+		c.fs.StringVar(&c.image, "image", "", "Image deployed to the copy instead of the current image of the source app")
+		c.fs.BoolVar(&c.withServices, "with-services", false, "Create and bind new instances of the services of the source app")
+	}
+	return c.fs
+}
+
+// cloneStep is a step of app-clone, with the step that undoes it, if any.
+type cloneStep struct {
+	description string
+	run         func(context *cmd.Context, client *cmd.Client) error
+	rollback    *cloneStep
+}
+
+func (c *appClone) Run(context *cmd.Context, client *cmd.Client) error {
+	source, dest := context.Args[0], context.Args[1]
+	if source == dest && c.target == "" {
+		return errors.New("the source and destination apps must be different")
+	}
+	destClient := client
+	if c.target != "" {
+		var err error
+		token := os.Getenv(targetTokenEnv)
+		if token == "" {
+			return fmt.Errorf("the token for target %q must be set in %s, as the credentials of the current target are not sent to it", c.target, targetTokenEnv)
+		}
+		destClient, err = targetClient(client, c.target, token)
+		if err != nil {
+			return err
+		}
+	}
+	manifest, err := exportApp(client, source)
+	if err != nil {
+		return err
+	}
+	var private []string
+	for name, value := range manifest.Env {
+		if value == privateEnvPlaceholder {
+			private = append(private, name)
+			delete(manifest.Env, name)
+		}
+	}
+	sort.Strings(private)
+	existing, err := getLiveApp(destClient, dest)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("app %q already exists", dest)
+	}
+	image := c.image
+	if image == "" {
+		image, err = currentImage(client, source)
+		if err != nil {
+			return err
+		}
+		if image != "" && c.target != "" {
+			return fmt.Errorf("the image of app %q (%s) is in the registry of the current target, push it to a registry target %q can pull from and use --image", source, image, c.target)
+		}
+	}
+	fmt.Fprintf(context.Stdout, "Cloning app %q to %q\n", source, dest)
+	var rollbacks []cloneStep
+	run := func(step cloneStep) error {
+		fmt.Fprintf(context.Stdout, "Cloning: %s\n", step.description)
+		err := step.run(context, destClient)
+		if err != nil {
+			err = fmt.Errorf("could not %s: %s", step.description, err)
+			return rollbackClone(context, destClient, rollbacks, err)
+		}
+		if step.rollback != nil {
+			rollbacks = append(rollbacks, *step.rollback)
+		}
+		return nil
+	}
+	clone := appManifest{
+		Name:      dest,
+		Platform:  manifest.Platform,
+		Plan:      manifest.Plan,
+		TeamOwner: manifest.TeamOwner,
+		Teams:     manifest.Teams,
+		Env:       manifest.Env,
+	}
+	create := createChange(&clone)
+	err = run(cloneStep{
+		description: create.description,
+		run:         create.apply,
+		rollback: &cloneStep{
+			description: fmt.Sprintf("remove app %s", dest),
+			run:         appCommandChange(&appRemove{}, dest, nil, "-y"),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	live, err := getLiveApp(destClient, dest)
+	if err == nil && live == nil {
+		err = fmt.Errorf("app %q was not found after being created", dest)
+	}
+	if err != nil {
+		return rollbackClone(context, destClient, rollbacks, err)
+	}
+	for _, change := range planManifest(&clone, live) {
+		if change.apply == nil {
+			continue
+		}
+		err = run(cloneStep{description: change.description, run: change.apply})
+		if err != nil {
+			return err
+		}
+	}
+	if c.withServices {
+		instances, err := cloneInstances(client, source, dest)
+		if err != nil {
+			return rollbackClone(context, destClient, rollbacks, err)
+		}
+		for _, instance := range instances {
+			description := fmt.Sprintf("create service instance %s of service %s", instance.name, instance.service)
+			if instance.plan != "" {
+				description += fmt.Sprintf(" (plan %s)", instance.plan)
+			}
+			err = run(cloneStep{
+				description: description,
+				run:         instance.create(clone.TeamOwner),
+				rollback: &cloneStep{
+					description: fmt.Sprintf("remove service instance %s", instance.name),
+					run:         instance.remove,
+				},
+			})
+			if err != nil {
+				return err
+			}
+			err = run(cloneStep{
+				description: fmt.Sprintf("bind service instance %s", instance.name),
+				run:         appCommandChange(&serviceBind{}, dest, []string{instance.name}),
+				rollback: &cloneStep{
+					description: fmt.Sprintf("unbind service instance %s", instance.name),
+					run:         appCommandChange(&serviceUnbind{}, dest, []string{instance.name}),
+				},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if image != "" {
+		err = run(cloneStep{
+			description: fmt.Sprintf("deploy image %s", image),
+			run: func(context *cmd.Context, client *cmd.Client) error {
+				deploy := appDeploy{image: image}
+				err := deploy.deployImage(context, client, dest)
+				if err == cmd.ErrAbortCommand {
+					err = errors.New("the deploy failed")
+				}
+				return err
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if manifest.Units != nil {
+		a, err := getApp(destClient, dest)
+		if err != nil {
+			return rollbackClone(context, destClient, rollbacks, err)
+		}
+		if delta := *manifest.Units - a.unitCount(); delta > 0 {
+			err = run(cloneStep{
+				description: fmt.Sprintf("add %d units (%d -> %d)", delta, a.unitCount(), *manifest.Units),
+				run:         appCommandChange(&unitAdd{}, dest, []string{strconv.Itoa(delta)}),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	fmt.Fprintf(context.Stdout, "App %q successfully cloned to %q!\n", source, dest)
+	var warnings []string
+	if image == "" {
+		warnings = append(warnings, fmt.Sprintf("app %q has no successful deploy, nothing was deployed to %q", source, dest))
+	}
+	if len(private) > 0 {
+		warnings = append(warnings, fmt.Sprintf("private environment variables were not copied, use env-set to set them: %s", strings.Join(private, ", ")))
+	}
+	if !c.withServices && len(manifest.Services) > 0 {
+		warnings = append(warnings, fmt.Sprintf("the copy is not bound to the service instances of %q (%s), use --with-services to create new instances", source, strings.Join(manifest.Services, ", ")))
+	}
+	writeWarnings(context.Stderr, warnings)
+	return nil
+}
+
+// rollbackClone undoes the steps of app-clone that already succeeded, in
+// reverse order, returning the error that caused the rollback.
+func rollbackClone(context *cmd.Context, client *cmd.Client, rollbacks []cloneStep, cause error) error {
+	var failed []string
+	for i := len(rollbacks) - 1; i >= 0; i-- {
+		step := rollbacks[i]
+		fmt.Fprintf(context.Stdout, "Rolling back: %s\n", step.description)
+		err := step.run(context, client)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("could not %s: %s", step.description, err))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s (rollback failed: %s)", cause, strings.Join(failed, "; "))
+	}
+	return cause
+}
+
+// currentImage returns the image of the latest successful deploy of the app,
+// or an empty string if the app was never deployed.
+func currentImage(client *cmd.Client, appName string) (string, error) {
+	deploys, err := listDeploys(client, appName, 0, rollbackDeploysLimit)
+	if err != nil {
+		return "", err
+	}
+	for _, deploy := range deploys {
+		if deploy.Error == "" {
+			return deploy.Image, nil
+		}
+	}
+	return "", nil
+}
+
+// clonedInstance is a service instance created for the copy of an app.
+type clonedInstance struct {
+	service string
+	name    string
+	plan    string
+}
+
+func (i clonedInstance) create(teamOwner string) func(*cmd.Context, *cmd.Client) error {
+	return func(context *cmd.Context, client *cmd.Client) error {
+		add := serviceAdd{}
+		add.Flags().Parse(true, []string{"-t", teamOwner})
+		ctx := cmd.Context{
+			Args:   []string{i.service, i.name, i.plan},
+			Stdout: context.Stdout,
+			Stderr: context.Stderr,
+			Stdin:  context.Stdin,
+		}
+		return add.Run(&ctx, client)
+	}
+}
+
+func (i clonedInstance) remove(context *cmd.Context, client *cmd.Client) error {
+	remove := serviceRemove{}
+	remove.Flags().Parse(true, []string{"-y"})
+	ctx := cmd.Context{
+		Args:   []string{i.name},
+		Stdout: context.Stdout,
+		Stderr: context.Stderr,
+		Stdin:  context.Stdin,
+	}
+	return remove.Run(&ctx, client)
+}
+
+// cloneInstances returns the service instances that must be created for the
+// copy of the app, one for each instance bound to the source app. The name
+// of the source app in the instance name is replaced by the name of the
+// copy, or the name of the copy is appended to it.
+func cloneInstances(client *cmd.Client, source, dest string) ([]clonedInstance, error) {
+	services, err := appServiceInstances(client, source)
+	if err != nil {
+		return nil, err
+	}
+	var instances []clonedInstance
+	for _, service := range services {
+		for _, name := range service.Instances {
+			body, _, err := apiGet(client, "/services/instances/"+name)
+			if err != nil {
+				return nil, fmt.Errorf("could not get service instance %s: %s", name, err)
+			}
+			var info struct {
+				PlanName string
+			}
+			err = json.Unmarshal(body, &info)
+			if err != nil {
+				return nil, fmt.Errorf("could not get service instance %s: %s", name, err)
+			}
+			newName := name + "-" + dest
+			if strings.Contains(name, source) {
+				newName = strings.Replace(name, source, dest, 1)
+			}
+			instances = append(instances, clonedInstance{service: service.Service, name: newName, plan: info.PlanName})
+		}
+	}
+	return instances, nil
+}
+
+// targetClient returns a client that sends the requests to the given target
+// instead of the current one, authenticated with the given token. The target
+// is the name of one of the targets listed by target-list, or its address.
+func targetClient(client *cmd.Client, target, token string) (*cmd.Client, error) {
+	address, err := targetAddress(target)
+	if err != nil {
+		return nil, err
+	}
+	current, err := cmd.GetURL("")
+	if err != nil {
+		return nil, err
+	}
+	transport := client.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	remote := *client
+	remote.HTTPClient = &http.Client{
+		Transport: &retargetTransport{from: current, to: address, token: token, base: transport},
+	}
+	return &remote, nil
+}
+
+var schemeRegexp = regexp.MustCompile("^https?://")
+
+// targetAddress returns the address of the target with the given name,
+// looking it up in the targets file. Addresses are returned unchanged.
+func targetAddress(target string) (string, error) {
+	address := ""
+	f, err := filesystem().Open(cmd.JoinWithUserDir(".tsuru_targets"))
+	if err == nil {
+		defer f.Close()
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			parts := strings.Split(strings.TrimSpace(scanner.Text()), "\t")
+			if len(parts) == 2 && parts[0] == target {
+				address = parts[1]
+				break
+			}
+		}
+	}
+	if address == "" {
+		if !schemeRegexp.MatchString(target) && !strings.ContainsAny(target, ".:") {
+			return "", fmt.Errorf("unknown target %q, use target-list to see the available targets", target)
+		}
+		address = target
+	}
+	if !schemeRegexp.MatchString(address) {
+		address = "http://" + address
+	}
+	return strings.TrimRight(address, "/"), nil
+}
+
+// retargetTransport sends the requests made to the current target to another
+// tsuru server, replacing the token of the current target with the token of
+// the other server. Requests to any other address are refused, so the token
+// of the current target never leaves it.
+type retargetTransport struct {
+	from  string
+	to    string
+	token string
+	base  http.RoundTripper
+}
+
+func (t *retargetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	u := req.URL.String()
+	if !strings.HasPrefix(u, t.from) {
+		return nil, fmt.Errorf("refusing to send a request to %s through target %s", u, t.to)
+	}
+	newURL, err := url.Parse(t.to + strings.TrimPrefix(u, t.from))
+	if err != nil {
+		return nil, err
+	}
+	retargeted := *req
+	retargeted.URL = newURL
+	retargeted.Host = newURL.Host
+	retargeted.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		retargeted.Header[k] = v
+	}
+	retargeted.Header.Set("Authorization", "bearer "+t.token)
+	return t.base.RoundTrip(&retargeted)
+}
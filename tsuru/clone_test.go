@@ -0,0 +1,226 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+func newCloneAPI() *fakeAPI {
+	api := newFakeAPI()
+	api.routes["GET /deploys"] = []string{`[{"Image":"tsuru/app-app1:v3","Error":"","CanRollback":true}]`}
+	api.routes["GET /services/instances/mysql1"] = []string{`{"Name":"mysql1","ServiceName":"mysql","PlanName":"small"}`}
+	api.routes["GET /services/instances/redis1"] = []string{`{"Name":"redis1","ServiceName":"redis"}`}
+	api.routes["GET /apps/app2"] = []string{
+		"404 App app2 not found.",
+		`{"name":"app2","platform":"python","teamowner":"myteam","teams":["myteam"]}`,
+		`{"name":"app2","platform":"python","teamowner":"myteam","teams":["myteam","qa"],"units":[{"Name":"app2/0","Status":"started"}]}`,
+	}
+	api.routes["GET /apps/app2/env"] = []string{"[]"}
+	api.routes["POST /apps"] = []string{`{"status":"success"}`}
+	api.routes["POST /apps/app2/deploy"] = []string{"deploying image\nOK\n"}
+	return api
+}
+
+func runAppClone(api http.RoundTripper, args ...string) (string, string, error) {
+	var stdout, stderr bytes.Buffer
+	command := appClone{}
+	command.Flags().Parse(true, args)
+	context := cmd.Context{
+		Args:   command.Flags().Args(),
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: api}, nil, manager)
+	err := command.Run(&context, client)
+	return stdout.String(), stderr.String(), err
+}
+
+func (s *S) TestAppCloneInfo(c *check.C) {
+	c.Assert((&appClone{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppClone(c *check.C) {
+	api := newCloneAPI()
+	out, errOut, err := runAppClone(api, "app1", "app2")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s)Cloning app "app1" to "app2"
+Cloning: create app app2 \(platform python, plan small, team owner myteam\)
+.*Cloning: grant access to team qa
+.*Cloning: set env DEBUG=true, WORKERS=4
+.*Cloning: deploy image tsuru/app-app1:v3
+deploying image
+OK
+Cloning: add 1 units \(1 -> 2\)
+.*App "app1" successfully cloned to "app2"!
+`)
+	c.Assert(errOut, check.Matches, `(?s).*private environment variables were not copied, use env-set to set them: SECRET
+.*the copy is not bound to the service instances of "app1" \(mysql1, redis1\), use --with-services to create new instances
+`)
+	c.Assert(api.changes, check.DeepEquals, []string{
+		`POST /apps {"name":"app2","plan":{"name":"small"},"platform":"python","teamOwner":"myteam"}`,
+		"PUT /apps/app2/teams/qa",
+		`POST /apps/app2/env {"DEBUG":"true","WORKERS":"4"}`,
+		"POST /apps/app2/deploy image=tsuru/app-app1:v3",
+		"PUT /apps/app2/units 1",
+	})
+}
+
+func (s *S) TestAppCloneWithServices(c *check.C) {
+	api := newCloneAPI()
+	out, _, err := runAppClone(api, "--with-services", "app1", "app2")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s).*Cloning: create service instance mysql1-app2 of service mysql \(plan small\)
+.*Cloning: bind service instance mysql1-app2
+.*Cloning: create service instance redis1-app2 of service redis
+.*Cloning: bind service instance redis1-app2
+.*`)
+	c.Assert(api.changes[3:7], check.DeepEquals, []string{
+		`POST /services/instances {"name":"mysql1-app2","owner":"myteam","plan":"small","service_name":"mysql"}`,
+		"PUT /services/instances/mysql1-app2/app2",
+		`POST /services/instances {"name":"redis1-app2","owner":"myteam","plan":"","service_name":"redis"}`,
+		"PUT /services/instances/redis1-app2/app2",
+	})
+}
+
+func (s *S) TestAppCloneRollback(c *check.C) {
+	api := newCloneAPI()
+	api.routes["POST /apps/app2/deploy"] = []string{"deploying image\nimage not found\n"}
+	out, _, err := runAppClone(api, "--with-services", "app1", "app2")
+	c.Assert(err, check.ErrorMatches, "could not deploy image tsuru/app-app1:v3: the deploy failed")
+	c.Assert(out, check.Matches, `(?s).*Rolling back: unbind service instance redis1-app2
+.*Rolling back: remove service instance redis1-app2
+.*Rolling back: unbind service instance mysql1-app2
+.*Rolling back: remove service instance mysql1-app2
+.*Rolling back: remove app app2
+.*`)
+	c.Assert(api.changes[8:], check.DeepEquals, []string{
+		"DELETE /services/instances/redis1-app2/app2",
+		"DELETE /services/instances/redis1-app2",
+		"DELETE /services/instances/mysql1-app2/app2",
+		"DELETE /services/instances/mysql1-app2",
+		"DELETE /apps/app2",
+	})
+}
+
+func (s *S) TestAppCloneRollbackFailure(c *check.C) {
+	api := newCloneAPI()
+	api.routes["PUT /apps/app2/teams/qa"] = []string{"404 Team not found"}
+	api.routes["DELETE /apps/app2"] = []string{"404 App not found"}
+	_, _, err := runAppClone(api, "app1", "app2")
+	c.Assert(err, check.ErrorMatches, `could not grant access to team qa: Team not found \(rollback failed: could not remove app app2: App not found\)`)
+}
+
+func (s *S) TestAppCloneDestinationExists(c *check.C) {
+	api := newCloneAPI()
+	api.routes["GET /apps/app2"] = api.routes["GET /apps/app2"][1:]
+	_, _, err := runAppClone(api, "app1", "app2")
+	c.Assert(err, check.ErrorMatches, `app "app2" already exists`)
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestAppCloneSameApp(c *check.C) {
+	_, _, err := runAppClone(newCloneAPI(), "app1", "app1")
+	c.Assert(err, check.ErrorMatches, "the source and destination apps must be different")
+}
+
+func (s *S) TestAppCloneTarget(c *check.C) {
+	fsystem = &fstest.RecordingFs{FileContent: "default\thttp://localhost:8080\nstaging\thttps://staging.example.com/\n"}
+	defer func() {
+		fsystem = nil
+	}()
+	os.Setenv(targetTokenEnv, "staging-token")
+	defer os.Unsetenv(targetTokenEnv)
+	api := newCloneAPI()
+	hosts := map[string]string{}
+	tokens := map[string]string{}
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		host := req.URL.Scheme + "://" + req.URL.Host
+		hosts[req.Method+" "+req.URL.Path] = host
+		if host == "https://staging.example.com" {
+			tokens[req.Header.Get("Authorization")] = host
+		}
+		return api.RoundTrip(req)
+	})
+	out, _, err := runAppClone(transport, "--target", "staging", "--image", "registry.example.com/app1:v3", "app1", "app2")
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(out, "Cloning: deploy image registry.example.com/app1:v3\n"), check.Equals, true)
+	c.Assert(hosts["GET /apps/app1"], check.Equals, "http://localhost:8080")
+	c.Assert(hosts["GET /apps/app2"], check.Equals, "https://staging.example.com")
+	c.Assert(hosts["POST /apps"], check.Equals, "https://staging.example.com")
+	c.Assert(hosts["POST /apps/app2/deploy"], check.Equals, "https://staging.example.com")
+	c.Assert(tokens, check.DeepEquals, map[string]string{"bearer staging-token": "https://staging.example.com"})
+}
+
+func (s *S) TestAppCloneTargetWithoutToken(c *check.C) {
+	os.Unsetenv(targetTokenEnv)
+	api := newCloneAPI()
+	_, _, err := runAppClone(api, "--target", "https://staging.example.com", "app1", "app2")
+	c.Assert(err, check.ErrorMatches, `the token for target "https://staging.example.com" must be set in TSURU_TARGET_TOKEN, as the credentials of the current target are not sent to it`)
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestAppCloneTargetWithoutImage(c *check.C) {
+	os.Setenv(targetTokenEnv, "staging-token")
+	defer os.Unsetenv(targetTokenEnv)
+	api := newCloneAPI()
+	_, _, err := runAppClone(api, "--target", "https://staging.example.com", "app1", "app2")
+	c.Assert(err, check.ErrorMatches, `the image of app "app1" \(tsuru/app-app1:v3\) is in the registry of the current target, push it to a registry target "https://staging.example.com" can pull from and use --image`)
+	c.Assert(api.changes, check.HasLen, 0)
+}
+
+func (s *S) TestTargetAddress(c *check.C) {
+	fsystem = &fstest.RecordingFs{FileContent: "default\thttp://localhost:8080\nstaging\tstaging.example.com:8080\n"}
+	defer func() {
+		fsystem = nil
+	}()
+	var tests = []struct {
+		target  string
+		address string
+	}{
+		{"default", "http://localhost:8080"},
+		{"staging", "http://staging.example.com:8080"},
+		{"https://prod.example.com/", "https://prod.example.com"},
+		{"prod.example.com", "http://prod.example.com"},
+	}
+	for _, t := range tests {
+		address, err := targetAddress(t.target)
+		c.Check(err, check.IsNil)
+		c.Check(address, check.Equals, t.address)
+	}
+	_, err := targetAddress("prod")
+	c.Assert(err, check.ErrorMatches, `unknown target "prod", use target-list to see the available targets`)
+}
+
+func (s *S) TestRetargetTransport(c *check.C) {
+	var requested, authorization string
+	base := transportFunc(func(req *http.Request) (*http.Response, error) {
+		requested = req.URL.String()
+		authorization = req.Header.Get("Authorization")
+		return &http.Response{Body: ioutil.NopCloser(strings.NewReader("")), StatusCode: http.StatusOK}, nil
+	})
+	transport := retargetTransport{from: "http://localhost:8080", to: "https://other:8443/tsuru", token: "other-token", base: base}
+	req, _ := http.NewRequest("GET", "http://localhost:8080/apps/app1?units=1", nil)
+	req.Header.Set("Authorization", "bearer current-token")
+	_, err := transport.RoundTrip(req)
+	c.Assert(err, check.IsNil)
+	c.Assert(requested, check.Equals, "https://other:8443/tsuru/apps/app1?units=1")
+	c.Assert(authorization, check.Equals, "bearer other-token")
+	c.Assert(req.URL.String(), check.Equals, "http://localhost:8080/apps/app1?units=1")
+	c.Assert(req.Header.Get("Authorization"), check.Equals, "bearer current-token")
+	requested = ""
+	req, _ = http.NewRequest("GET", "http://elsewhere:8080/apps", nil)
+	_, err = transport.RoundTrip(req)
+	c.Assert(err, check.ErrorMatches, "refusing to send a request to http://elsewhere:8080/apps through target https://other:8443/tsuru")
+	c.Assert(requested, check.Equals, "")
+}
@@ -8,16 +8,23 @@ import (
 	"archive/tar"
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	pathpkg "path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
 	tsuruapp "github.com/tsuru/tsuru/app"
@@ -26,48 +33,173 @@ import (
 	"launchpad.net/gnuflag"
 )
 
+const defaultDeployListLimit = 10
+
 type appDeployList struct {
 	cmd.GuessingCommand
+	limit      int
+	skip       int
+	page       int
+	user       string
+	origin     string
+	since      string
+	until      string
+	failedOnly bool
+	json       bool
+	fs         *gnuflag.FlagSet
+}
+
+func (c *appDeployList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.IntVar(&c.limit, "limit", defaultDeployListLimit, "Maximum number of deploys to list")
+		c.fs.IntVar(&c.skip, "skip", 0, "Number of deploys to skip")
+		c.fs.IntVar(&c.page, "page", 0, "Page of deploys to list, starting at 1, each page has --limit deploys")
+		c.fs.StringVar(&c.user, "user", "", "List only deploys made by this user")
+		c.fs.StringVar(&c.origin, "origin", "", "List only deploys with this origin (e.g. git, app-deploy, image, rollback)")
+		c.fs.StringVar(&c.since, "since", "", "List only deploys made after this date (YYYY-MM-DD, RFC 3339 or a duration like 24h)")
+		c.fs.StringVar(&c.until, "until", "", "List only deploys made before this date (YYYY-MM-DD, RFC 3339 or a duration like 24h)")
+		c.fs.BoolVar(&c.failedOnly, "failed-only", false, "List only deploys that failed")
+		c.fs.BoolVar(&c.json, "json", false, "Print the deploys in JSON format")
+	}
+	return c.fs
 }
 
 func (c *appDeployList) Info() *cmd.Info {
+	desc := `List information about deploys for an application.
+
+By default, the latest 10 deploys are listed. Use [[--limit]] to change the
+number of deploys and [[--skip]] or [[--page]] to list older ones. The
+deploys can be filtered by user, origin, date and by failures, and the
+[[--json]] flag prints the full records of the deploys, to be consumed by
+other tools.
+
+Dates given in [[--since]] and [[--until]] may be in the YYYY-MM-DD or
+RFC 3339 formats, or be a duration relative to now, like [[24h]].`
 	return &cmd.Info{
 		Name:  "app-deploy-list",
-		Usage: "app-deploy-list [-a/--app <appname>]",
-		Desc:  "List information about deploys for an application.",
+		Usage: "app-deploy-list [-a/--app <appname>] [--limit <n>] [--skip <n> | --page <n>] [--user <email>] [--origin <origin>] [--since <date>] [--until <date>] [--failed-only] [--json]",
+		Desc:  desc,
 	}
 }
 
-func (c *appDeployList) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
+// deployFilter selects deploys on the client side, for the filters that are
+// not supported by the API.
+type deployFilter struct {
+	user       string
+	origin     string
+	since      time.Time
+	until      time.Time
+	failedOnly bool
+}
+
+func (f *deployFilter) empty() bool {
+	return *f == deployFilter{}
+}
+
+func (f *deployFilter) match(deploy *tsuruapp.DeployData) bool {
+	if f.user != "" && deploy.User != f.user {
+		return false
 	}
-	url, err := cmd.GetURL(fmt.Sprintf("/deploys?app=%s&limit=10", appName))
-	if err != nil {
-		return err
+	if f.origin != "" && deploy.Origin != f.origin {
+		return false
 	}
-	request, err := http.NewRequest("GET", url, nil)
+	if !f.since.IsZero() && deploy.Timestamp.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && deploy.Timestamp.After(f.until) {
+		return false
+	}
+	if f.failedOnly && deploy.Error == "" {
+		return false
+	}
+	return true
+}
+
+// parseDeployTime parses the dates given in --since and --until.
+func parseDeployTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, use YYYY-MM-DD, RFC 3339 or a duration like 24h", value)
+}
+
+func (c *appDeployList) filter() (*deployFilter, error) {
+	since, err := parseDeployTime(c.since)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	response, err := client.Do(request)
+	until, err := parseDeployTime(c.until)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if response.StatusCode == http.StatusNoContent {
-		return nil
+	return &deployFilter{
+		user:       c.user,
+		origin:     c.origin,
+		since:      since,
+		until:      until,
+		failedOnly: c.failedOnly,
+	}, nil
+}
+
+func (c *appDeployList) Run(context *cmd.Context, client *cmd.Client) error {
+	limit := c.limit
+	if limit == 0 {
+		limit = defaultDeployListLimit
 	}
-	defer response.Body.Close()
-	result, err := ioutil.ReadAll(response.Body)
+	if limit < 0 || c.skip < 0 || c.page < 0 {
+		return errors.New("the limit, skip and page values can't be negative")
+	}
+	if c.skip > 0 && c.page > 0 {
+		return errors.New("please use only one of --skip and --page")
+	}
+	skip := c.skip
+	if c.page > 0 {
+		skip = (c.page - 1) * limit
+	}
+	filter, err := c.filter()
 	if err != nil {
 		return err
 	}
-	var deploys []tsuruapp.DeployData
-	err = json.Unmarshal(result, &deploys)
+	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
+	var deploys []tsuruapp.DeployData
+	if filter.empty() {
+		deploys, err = listDeploys(client, appName, skip, limit)
+		if err != nil {
+			return err
+		}
+	} else {
+		deploys, err = c.filteredDeploys(client, appName, filter, skip, limit)
+		if err != nil {
+			return err
+		}
+	}
+	if c.json {
+		if deploys == nil {
+			deploys = []tsuruapp.DeployData{}
+		}
+		data, err := json.MarshalIndent(deploys, "", "  ")
+		if err != nil {
+			return err
+		}
+		context.Stdout.Write(append(data, '\n'))
+		return nil
+	}
+	if len(deploys) == 0 {
+		return nil
+	}
 	table := cmd.NewTable()
 	table.Headers = cmd.Row([]string{"Image (Rollback)", "Origin", "User", "Date (Duration)", "Error"})
 	for _, deploy := range deploys {
@@ -75,7 +207,16 @@ func (c *appDeployList) Run(context *cmd.Context, client *cmd.Client) error {
 		seconds := deploy.Duration / time.Second
 		minutes := seconds / 60
 		seconds = seconds % 60
-		if deploy.Origin == "git" {
+		// Deploys of archives record the hash of the archive as the commit,
+		// whatever their origin, and deploys of git refs made with
+		// app-deploy record the commit too.
+		if strings.HasPrefix(deploy.Commit, archiveHashPrefix) {
+			hash := strings.TrimPrefix(deploy.Commit, archiveHashPrefix)
+			if len(hash) > 7 {
+				hash = hash[:7]
+			}
+			deploy.Origin = fmt.Sprintf("%s (%s%s)", deploy.Origin, archiveHashPrefix, hash)
+		} else if deploy.Origin == "git" || (deploy.Origin == "app-deploy" && deploy.Commit != "") {
 			if len(deploy.Commit) > 7 {
 				deploy.Commit = deploy.Commit[:7]
 			}
@@ -100,8 +241,196 @@ func (c *appDeployList) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
+// filteredDeploys walks the deploys of the app, newest first, fetching them
+// in pages until enough of them match the filter.
+func (c *appDeployList) filteredDeploys(client *cmd.Client, appName string, filter *deployFilter, skip, limit int) ([]tsuruapp.DeployData, error) {
+	var result []tsuruapp.DeployData
+	for offset := 0; ; offset += limit {
+		deploys, err := listDeploys(client, appName, offset, limit)
+		if err != nil {
+			return nil, err
+		}
+		for i := range deploys {
+			if !filter.since.IsZero() && deploys[i].Timestamp.Before(filter.since) {
+				return result, nil
+			}
+			if !filter.match(&deploys[i]) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			result = append(result, deploys[i])
+			if len(result) == limit {
+				return result, nil
+			}
+		}
+		if len(deploys) < limit {
+			return result, nil
+		}
+	}
+}
+
+// listDeploys returns a page of the deploys of the app, newest first.
+func listDeploys(client *cmd.Client, appName string, skip, limit int) ([]tsuruapp.DeployData, error) {
+	query := fmt.Sprintf("/deploys?app=%s&limit=%d", appName, limit)
+	if skip > 0 {
+		query += fmt.Sprintf("&skip=%d", skip)
+	}
+	url, err := cmd.GetURL(query)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return nil, nil
+	}
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var deploys []tsuruapp.DeployData
+	err = json.Unmarshal(result, &deploys)
+	if err != nil {
+		return nil, err
+	}
+	return deploys, nil
+}
+
+// deployInfo is a deploy as returned by the /deploys/<id> endpoint, which
+// includes the output of the deploy.
+type deployInfo struct {
+	tsuruapp.DeployData
+	Log string
+}
+
+type appDeployInfo struct {
+	json bool
+	fs   *gnuflag.FlagSet
+}
+
+func (c *appDeployInfo) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-deploy-info", gnuflag.ExitOnError)
+		c.fs.BoolVar(&c.json, "json", false, "Print the deploy in JSON format")
+	}
+	return c.fs
+}
+
+func (c *appDeployInfo) Info() *cmd.Info {
+	desc := `Shows information about a deploy, including the output of the build and
+of the deploy. The id of the deploys is available in the output of
+[[tsuru app-deploy-list --json]].`
+	return &cmd.Info{
+		Name:    "app-deploy-info",
+		Usage:   "app-deploy-info <deploy-id> [--json]",
+		Desc:    desc,
+		MinArgs: 1,
+	}
+}
+
+func (c *appDeployInfo) Run(context *cmd.Context, client *cmd.Client) error {
+	url, err := cmd.GetURL("/deploys/" + context.Args[0])
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	var deploy deployInfo
+	err = json.NewDecoder(response.Body).Decode(&deploy)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		data, err := json.MarshalIndent(deploy, "", "  ")
+		if err != nil {
+			return err
+		}
+		context.Stdout.Write(append(data, '\n'))
+		return nil
+	}
+	canRollback := "no"
+	if deploy.CanRollback {
+		canRollback = "yes"
+	}
+	fmt.Fprintf(context.Stdout, "ID: %s\n", deploy.ID)
+	fmt.Fprintf(context.Stdout, "App: %s\n", deploy.App)
+	fmt.Fprintf(context.Stdout, "Image: %s\n", deploy.Image)
+	fmt.Fprintf(context.Stdout, "Origin: %s\n", deploy.Origin)
+	if deploy.Commit != "" {
+		fmt.Fprintf(context.Stdout, "Commit: %s\n", deploy.Commit)
+	}
+	fmt.Fprintf(context.Stdout, "User: %s\n", deploy.User)
+	fmt.Fprintf(context.Stdout, "Date: %s\n", deploy.Timestamp.Local().Format(time.Stamp))
+	fmt.Fprintf(context.Stdout, "Duration: %s\n", formatDuration(deploy.Duration))
+	fmt.Fprintf(context.Stdout, "Can rollback: %s\n", canRollback)
+	if deploy.Error != "" {
+		fmt.Fprintf(context.Stdout, "Error: %s\n", cmd.Colorfy(deploy.Error, "red", "", ""))
+	}
+	if deploy.Log != "" {
+		fmt.Fprintf(context.Stdout, "\nLog:\n%s", deploy.Log)
+		if !strings.HasSuffix(deploy.Log, "\n") {
+			fmt.Fprintln(context.Stdout)
+		}
+	}
+	return nil
+}
+
+// deployRetryDelay is the time app-deploy waits before retrying a failed
+// upload for the first time. The delay doubles on each retry, up to
+// maxDeployRetryDelay.
+var deployRetryDelay = 2 * time.Second
+
+const maxDeployRetryDelay = time.Minute
+
 type appDeploy struct {
 	cmd.GuessingCommand
+	ignoreFile     string
+	dryRun         bool
+	retries        int
+	followSymlinks bool
+	reproducible   bool
+	skipUnchanged  bool
+	gitURL         string
+	gitRef         string
+	image          string
+	wait           bool
+	timeout        time.Duration
+	fs             *gnuflag.FlagSet
+}
+
+func (c *appDeploy) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.ignoreFile, "ignore-file", "", "Path to a file with patterns of files that should not be deployed (default: .tsuruignore in the deploy root)")
+		c.fs.BoolVar(&c.dryRun, "dry-run", false, "List the files that would be deployed and the size of the archive, without deploying")
+		c.fs.IntVar(&c.retries, "retries", 3, "Number of times the upload is retried after a connection failure")
+		c.fs.BoolVar(&c.followSymlinks, "follow-symlinks", false, "Archive the files and directories symlinks point to, instead of the links themselves")
+		c.fs.BoolVar(&c.reproducible, "reproducible", false, "Build the same archive for the same files, regardless of timestamps and ownership, and print its SHA-256")
+		c.fs.BoolVar(&c.skipUnchanged, "skip-unchanged", false, "Don't deploy when the archive is the same as the one of the latest deploy (implies --reproducible)")
+		c.fs.StringVar(&c.gitURL, "git", "", "URL of a git repository to deploy, instead of local files")
+		c.fs.StringVar(&c.gitRef, "ref", "", "Branch, tag or commit to deploy from the repository given in --git, or from the repository in the current directory")
+		c.fs.StringVar(&c.image, "image", "", "Reference of an existing container image to deploy, instead of local files")
+		c.fs.BoolVar(&c.wait, "wait", false, "Wait for all units of the app to start after the deploy")
+		c.fs.DurationVar(&c.timeout, "timeout", defaultDeployWaitTimeout, "How long to wait for the units to start, when --wait is given")
+	}
+	return c.fs
 }
 
 func (c *appDeploy) Info() *cmd.Info {
@@ -113,55 +442,353 @@ calls are:
     $ tsuru app-deploy .
     $ tsuru app-deploy myfile.jar Procfile
     $ tsuru app-deploy mysite
+
+Files matching the patterns listed in the [[.tsuruignore]] file, located in the
+deploy root, are not sent to the server. The file uses the same syntax as
+[[.gitignore]], including negation with [[!]], directory patterns ending in
+[[/]] and [[**]] to match any number of directories. The deploy root is the
+directory being deployed when a single directory is given, or the current
+directory otherwise. Use [[--ignore-file]] to read the patterns from another
+file.
+
+The [[--dry-run]] flag lists the files that would be deployed and the size of
+the resulting archive, without sending anything to the server. With
+[[--image]], it only displays the image that would be deployed.
+
+When the upload fails because the connection to the server couldn't be
+established, or was reset while the archive was being sent, it's retried from
+the start with an exponential backoff. The [[--retries]] flag sets how many
+times the upload is retried, the default is 3. Other failures, like
+certificate errors, timeouts and error responses, including gateway errors,
+are never retried, as the server may already be running the deploy.
+
+Symlinks are sent as links, so they must point to a path that exists in the
+application. Use [[--follow-symlinks]] to send the files and directories they
+point to instead. File permissions, including the executable bit, and
+modification times are kept in the archive.
+
+The [[--reproducible]] flag makes the archive depend only on the name, content
+and permissions of the files: entries are sorted and timestamps and ownership
+are zeroed. The SHA-256 of the archive is printed and recorded in the deploy.
+With [[--skip-unchanged]], a reproducible archive is built and compared with
+the one from the latest successful deploy of the application, and nothing is
+uploaded when they're the same. When deploying a git ref, the commit id is
+compared instead.
+
+Instead of local files, a git ref can be deployed with [[--ref]], either from
+the repository in the current directory or from the remote repository given
+in [[--git]] (the default ref is HEAD). The tree of the ref is exported to a
+temporary directory, without touching the working copy, and the id of the
+commit is recorded in the deploy:
+
+::
+
+    $ tsuru app-deploy --ref v1.2.0
+    $ tsuru app-deploy --git https://github.com/tsuru/tsuru-dashboard.git --ref master
+
+Images built elsewhere can be deployed with [[--image]], which takes the
+reference of an image available in a registry reachable by tsuru. Nothing is
+uploaded in this case, and the deploy is listed with the "image" origin by
+[[tsuru app-deploy-list]]:
+
+::
+
+    $ tsuru app-deploy --image registry.example.com/myapp:v1.2.0
+
+With [[--wait]], after the deploy finishes the command waits until all units
+of the app are started. It fails, displaying the status of each unit, when
+the units don't start before the [[--timeout]] (5m by default), or when they
+keep failing after the deploy.
+
+Commands can be run in the local machine before and after the deploy, by
+listing them in the [[client-hooks]] section of the [[tsuru.yaml]] file in
+the deploy root:
+
+::
+
+    client-hooks:
+      pre-deploy:
+        - make assets
+      post-deploy:
+        - ./notify-chat.sh
+
+The commands run in the deploy root, with the name of the app in the
+[[TSURU_APP]] environment variable and the address of the tsuru server in
+[[TSURU_TARGET]]. The deploy is aborted when a pre-deploy hook fails.
+Post-deploy hooks run after the deploy, either when it succeeds or fails, and
+get its result in [[TSURU_DEPLOY_RESULT]] (success, failure or skipped) and
+the error in [[TSURU_DEPLOY_ERROR]].
 `
 	return &cmd.Info{
 		Name:    "app-deploy",
-		Usage:   "app-deploy [-a/--app <appname>] <file-or-dir-1> [file-or-dir-2] ... [file-or-dir-n]",
+		Usage:   "app-deploy [-a/--app <appname>] [--ignore-file <file>] [--dry-run] [--retries <n>] [--follow-symlinks] [--reproducible] [--skip-unchanged] <file-or-dir-1> [file-or-dir-2] ... [file-or-dir-n] | [--git <url>] --ref <ref> | --image <image> [--wait [--timeout <duration>]]",
 		Desc:    desc,
-		MinArgs: 1,
+		MinArgs: 0,
 	}
 }
 
 func (c *appDeploy) Run(context *cmd.Context, client *cmd.Client) error {
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-	file, err := writer.CreateFormFile("file", "archive.tar.gz")
+	var gitCommit string
+	if c.image != "" {
+		if len(context.Args) > 0 || c.gitURL != "" || c.gitRef != "" {
+			return errors.New("files, directories and git refs can't be deployed along with --image")
+		}
+		if c.dryRun {
+			fmt.Fprintf(context.Stdout, "Image that would be deployed: %s\n", c.image)
+			return nil
+		}
+	} else if c.gitURL != "" || c.gitRef != "" {
+		if len(context.Args) > 0 {
+			return errors.New("files and directories can't be deployed along with --git or --ref")
+		}
+		tmpDir, err := ioutil.TempDir("", "tsuru-deploy")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(tmpDir)
+		tree := filepath.Join(tmpDir, "tree")
+		source := gitSource{url: c.gitURL, ref: c.gitRef}
+		gitCommit, err = source.export(tmpDir, tree)
+		if err != nil {
+			return err
+		}
+		if c.dryRun {
+			fmt.Fprintf(context.Stdout, "Commit that would be deployed: %s\n", gitCommit)
+		} else {
+			fmt.Fprintf(context.Stdout, "Deploying commit %s\n", gitCommit)
+		}
+		gitContext := *context
+		gitContext.Args = []string{tree}
+		context = &gitContext
+	} else if len(context.Args) == 0 {
+		return errors.New("you must provide at least one file or directory to deploy, or a git ref with --ref")
+	}
+	if c.dryRun {
+		opts, err := c.archiveOptions(context.Args)
+		if err != nil {
+			return err
+		}
+		return c.dryRunDeploy(context, opts)
+	}
+	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
-	err = targz(context, file, context.Args...)
+	root := "."
+	if c.image == "" {
+		root = deployRoot(context.Args)
+	}
+	hooks, err := readDeployHooks(root)
 	if err != nil {
 		return err
 	}
-	writer.Close()
-	appName, err := c.Guess()
+	runner := hookRunner{context: context, dir: root, appName: appName}
+	err = runner.runPreDeploy(hooks)
 	if err != nil {
 		return err
 	}
-	url, err := cmd.GetURL("/apps/" + appName + "/deploy")
+	if c.image != "" {
+		err = c.deployImage(context, client, appName)
+	} else {
+		err = c.deployFiles(context, client, appName, gitCommit)
+	}
+	if err == nil {
+		err = c.waitUnits(context, client, appName)
+	}
+	hookErr := runner.runPostDeploy(hooks, err)
+	if err == errDeploySkipped {
+		err = nil
+	}
+	if err != nil {
+		if hookErr != nil {
+			fmt.Fprintf(context.Stderr, "Warning: %s\n", hookErr)
+		}
+		return err
+	}
+	return hookErr
+}
+
+// errDeploySkipped is returned by deployFiles when --skip-unchanged is given
+// and the archive didn't change since the latest deploy.
+var errDeploySkipped = errors.New("deploy skipped, nothing changed since the latest deploy")
+
+// archiveOptions returns the options used to build the archive with the
+// given files.
+func (c *appDeploy) archiveOptions(filepaths []string) (archiveOptions, error) {
+	ignore, err := c.ignoreList(filepaths)
+	if err != nil {
+		return archiveOptions{}, err
+	}
+	return archiveOptions{
+		ignore:         ignore,
+		followSymlinks: c.followSymlinks,
+		reproducible:   c.reproducible || c.skipUnchanged,
+	}, nil
+}
+
+// deployFiles archives the files given in the command line and uploads them
+// to the server, streaming the output of the deploy.
+func (c *appDeploy) deployFiles(context *cmd.Context, client *cmd.Client, appName, gitCommit string) error {
+	for _, path := range context.Args {
+		if path == ".." {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	opts, err := c.archiveOptions(context.Args)
 	if err != nil {
 		return err
 	}
-	request, err := http.NewRequest("POST", url, &body)
+	commit := gitCommit
+	if opts.reproducible {
+		var hash string
+		hash, err = archiveHash(context, opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "Archive SHA-256: %s\n", hash)
+		if commit == "" {
+			commit = archiveHashPrefix + hash
+		}
+		if c.skipUnchanged {
+			var unchanged bool
+			unchanged, err = lastDeployHasCommit(client, appName, commit)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				fmt.Fprintln(context.Stdout, "Nothing changed since the latest deploy, skipping it.")
+				return errDeploySkipped
+			}
+		}
+	}
+	url, err := cmd.GetURL("/apps/" + appName + "/deploy")
 	if err != nil {
 		return err
 	}
-	request.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
-	var buf bytes.Buffer
-	respBody := firstWriter{Writer: io.MultiWriter(context.Stdout, &buf)}
-	go func() {
-		fmt.Fprint(context.Stdout, "Uploading files..")
-		for buf.Len() == 0 {
-			fmt.Fprint(context.Stdout, ".")
-			time.Sleep(2e9)
+	var resp *http.Response
+	for attempt := 1; ; attempt++ {
+		resp, err = c.upload(context, client, url, opts, commit)
+		uploadErr, ok := err.(*uploadError)
+		if !ok {
+			break
 		}
-	}()
+		if attempt > c.retries {
+			return uploadErr.err
+		}
+		delay := deployRetryDelay << uint(attempt-1)
+		if delay > maxDeployRetryDelay {
+			delay = maxDeployRetryDelay
+		}
+		fmt.Fprintf(context.Stderr, "Upload failed: %s. Retrying in %s (retry %d of %d)...\n", uploadErr.err, delay, attempt, c.retries)
+		time.Sleep(delay)
+	}
+	if err != nil {
+		return err
+	}
+	return streamDeployOutput(context, resp)
+}
+
+// deployImage asks the server to deploy the image given in --image.
+func (c *appDeploy) deployImage(context *cmd.Context, client *cmd.Client, appName string) error {
+	url, err := cmd.GetURL("/apps/" + appName + "/deploy?origin=image")
+	if err != nil {
+		return err
+	}
+	body := strings.NewReader("image=" + c.image)
+	request, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	resp, err := client.Do(request)
 	if err != nil {
 		return err
 	}
+	return streamDeployOutput(context, resp)
+}
+
+const defaultDeployWaitTimeout = 5 * time.Minute
+
+// deployWaitInterval is the interval between checks of the units status
+// when app-deploy runs with --wait.
+var deployWaitInterval = 2 * time.Second
+
+// maxUnitErrors is the number of consecutive checks in which a unit may be
+// found in the error state before app-deploy --wait considers it's crashing.
+const maxUnitErrors = 3
+
+// waitUnits waits until all units of the app are started, when --wait is
+// given.
+func (c *appDeploy) waitUnits(context *cmd.Context, client *cmd.Client, appName string) error {
+	if !c.wait {
+		return nil
+	}
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = defaultDeployWaitTimeout
+	}
+	fmt.Fprintln(context.Stdout, "Waiting for units to start...")
+	deadline := time.Now().Add(timeout)
+	unitErrors := make(map[string]int)
+	for {
+		a, err := getApp(client, appName)
+		if err != nil {
+			return err
+		}
+		if len(a.Units) == 0 {
+			fmt.Fprintln(context.Stdout, "The app has no units, nothing to wait for.")
+			return nil
+		}
+		started := true
+		var crashing []string
+		for _, unit := range a.Units {
+			if unit.Status != "started" {
+				started = false
+			}
+			if unit.Status != "error" {
+				delete(unitErrors, unit.Name)
+				continue
+			}
+			unitErrors[unit.Name]++
+			if unitErrors[unit.Name] >= maxUnitErrors {
+				crashing = append(crashing, unit.Name)
+			}
+		}
+		if started {
+			fmt.Fprintln(context.Stdout, "All units started.")
+			return nil
+		}
+		if len(crashing) > 0 {
+			context.Stdout.Write(unitsStatusTable(a.Units))
+			return fmt.Errorf("units keep failing after the deploy: %s", strings.Join(crashing, ", "))
+		}
+		if !time.Now().Before(deadline) {
+			context.Stdout.Write(unitsStatusTable(a.Units))
+			return fmt.Errorf("timed out after %s waiting for the units of app %q to start", timeout, appName)
+		}
+		time.Sleep(deployWaitInterval)
+	}
+}
+
+func unitsStatusTable(units []unit) []byte {
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Unit", "Status"})
+	for _, unit := range units {
+		table.AddRow(cmd.Row([]string{unit.Name, unit.Status}))
+	}
+	return table.Bytes()
+}
+
+// streamDeployOutput copies the output of a deploy to the context, failing
+// unless the server finishes it with the OK line.
+func streamDeployOutput(context *cmd.Context, resp *http.Response) error {
+	var buf bytes.Buffer
+	respBody := io.MultiWriter(context.Stdout, &buf)
 	defer resp.Body.Close()
-	_, err = io.Copy(&respBody, resp.Body)
+	_, err := io.Copy(respBody, resp.Body)
 	if err != nil {
 		return err
 	}
@@ -171,82 +798,343 @@ func (c *appDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 	return cmd.ErrAbortCommand
 }
 
-func targz(ctx *cmd.Context, destination io.Writer, filepaths ...string) error {
-	var buf bytes.Buffer
-	tarWriter := tar.NewWriter(&buf)
-	for _, path := range filepaths {
-		if path == ".." {
-			fmt.Fprintf(ctx.Stderr, "Warning: skipping %q", path)
-			continue
-		}
-		fi, err := os.Stat(path)
-		if err != nil {
-			return err
+// uploadError is returned by upload when the request fails because of a
+// failure in the connection with the server before it could have received
+// the whole archive, so the deploy didn't start.
+type uploadError struct {
+	err error
+}
+
+func (e *uploadError) Error() string {
+	return e.err.Error()
+}
+
+// upload sends the deploy archive to the server, returning the response
+// once the server starts streaming the deploy output. The commit, when not
+// empty, is recorded in the deploy.
+func (c *appDeploy) upload(context *cmd.Context, client *cmd.Client, url string, opts archiveOptions, commit string) (*http.Response, error) {
+	progress := newProgressReporter(context.Stdout, archiveSize(opts, context.Args...))
+	opts.progress = progress
+	body, bodyWriter := io.Pipe()
+	writer := multipart.NewWriter(progress.Writer(bodyWriter))
+	archiveErr := make(chan error, 1)
+	go func() {
+		err := writeDeployBody(context, writer, opts, commit)
+		bodyWriter.CloseWithError(err)
+		archiveErr <- err
+	}()
+	request, err := http.NewRequest("POST", url, body)
+	if err != nil {
+		body.Close()
+		<-archiveErr
+		return nil, err
+	}
+	// The size of the archive is not known in advance, so the body is sent
+	// with chunked transfer encoding.
+	request.ContentLength = -1
+	request.Header.Set("Content-Type", "multipart/form-data; boundary="+writer.Boundary())
+	// The client hides the errors of the connection, so they're recorded by
+	// the transport to tell which of them can be retried.
+	transport := client.HTTPClient.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	recorder := &transportErrorRecorder{base: transport}
+	httpClient := *client.HTTPClient
+	httpClient.Transport = recorder
+	uploadClient := *client
+	uploadClient.HTTPClient = &httpClient
+	progress.Start()
+	resp, err := uploadClient.Do(request)
+	// Unblocks the archive writer in case the server answered without
+	// reading the whole body.
+	body.Close()
+	aErr := <-archiveErr
+	if aErr == io.ErrClosedPipe {
+		aErr = nil
+	}
+	if aErr != nil {
+		if resp != nil {
+			resp.Body.Close()
 		}
-		if fi.IsDir() {
-			if len(filepaths) == 1 && path != "." {
-				return singleDir(ctx, destination, path)
-			}
-			err = addDir(tarWriter, path)
-		} else {
-			err = addFile(tarWriter, path)
+		progress.Stop(aErr)
+		return nil, aErr
+	}
+	progress.Stop(err)
+	if err != nil {
+		if isTransientError(recorder.err) {
+			return nil, &uploadError{err: err}
 		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// transportErrorRecorder records the error returned by the last request
+// sent through it.
+type transportErrorRecorder struct {
+	base http.RoundTripper
+	err  error
+}
+
+func (t *transportErrorRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	t.err = err
+	return resp, err
+}
+
+// isTransientError reports whether the upload failed before the server
+// could have received the whole archive: the connection couldn't be
+// established, or it was reset or closed while the archive was being sent.
+// Any other error, like a certificate error, a timeout waiting for the
+// response or an error response, is permanent, as the server may already be
+// running the deploy.
+func isTransientError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	opErr, ok := err.(*net.OpError)
+	if !ok {
+		return false
+	}
+	if opErr.Op == "dial" {
+		return true
+	}
+	if opErr.Op != "write" {
+		return false
+	}
+	err = opErr.Err
+	if sysErr, ok := err.(*os.SyscallError); ok {
+		err = sysErr.Err
+	}
+	return err == syscall.ECONNRESET || err == syscall.EPIPE
+}
+
+// writeDeployBody writes the multipart form with the deploy archive to the
+// given writer, compressing files as they are read from disk.
+func writeDeployBody(context *cmd.Context, writer *multipart.Writer, opts archiveOptions, commit string) error {
+	if commit != "" {
+		err := writer.WriteField("commit", commit)
 		if err != nil {
 			return err
 		}
 	}
-	err := tarWriter.Close()
+	file, err := writer.CreateFormFile("file", "archive.tar.gz")
 	if err != nil {
 		return err
 	}
-	gzipWriter := gzip.NewWriter(destination)
-	defer gzipWriter.Close()
-	_, err = io.Copy(gzipWriter, &buf)
-	return err
+	err = targz(context, file, opts, context.Args...)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// ignoreList loads the patterns of files that must be left out of the
+// archive, either from the file given in --ignore-file or from the
+// .tsuruignore file in the deploy root.
+func (c *appDeploy) ignoreList(filepaths []string) (*ignoreList, error) {
+	if c.ignoreFile != "" {
+		return readIgnoreFile(c.ignoreFile, false)
+	}
+	return readIgnoreFile(filepath.Join(deployRoot(filepaths), ignoreFileName), true)
+}
+
+// deployRoot returns the root of the deploy, where the .tsuruignore and the
+// project files are looked up: the directory being deployed, when a single
+// directory is given, or the current directory otherwise.
+func deployRoot(filepaths []string) string {
+	if len(filepaths) == 1 {
+		if fi, err := os.Stat(filepaths[0]); err == nil && fi.IsDir() {
+			return filepaths[0]
+		}
+	}
+	return "."
 }
 
-func singleDir(ctx *cmd.Context, destination io.Writer, path string) error {
-	old, err := os.Getwd()
+func (c *appDeploy) dryRunDeploy(context *cmd.Context, opts archiveOptions) error {
+	var files bytes.Buffer
+	var archive countingWriter
+	hash := sha256.New()
+	opts.entries = &files
+	err := targz(context, io.MultiWriter(&archive, hash), opts, context.Args...)
 	if err != nil {
 		return err
 	}
-	defer os.Chdir(old)
-	err = os.Chdir(path)
+	fmt.Fprintln(context.Stdout, "Files that would be deployed:")
+	context.Stdout.Write(files.Bytes())
+	fmt.Fprintf(context.Stdout, "Archive size: %s\n", formatSize(archive.n))
+	if opts.reproducible {
+		fmt.Fprintf(context.Stdout, "Archive SHA-256: %x\n", hash.Sum(nil))
+	}
+	return nil
+}
+
+// archiveHashPrefix identifies the commit of deploys made with a
+// reproducible archive, where the commit is the SHA-256 of the archive.
+const archiveHashPrefix = "sha256:"
+
+// archiveHash builds the archive without sending it anywhere, returning its
+// SHA-256 in hexadecimal.
+func archiveHash(context *cmd.Context, opts archiveOptions) (string, error) {
+	hash := sha256.New()
+	err := targz(context, hash, opts, context.Args...)
 	if err != nil {
-		return err
+		return "", err
 	}
-	return targz(ctx, destination, ".")
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
-func addDir(writer *tar.Writer, path string) error {
-	dir, err := os.Open(path)
+// lastDeployHasCommit reports whether the latest deploy of the app succeeded
+// and recorded the given commit.
+func lastDeployHasCommit(client *cmd.Client, appName, commit string) (bool, error) {
+	url, err := cmd.GetURL(fmt.Sprintf("/deploys?app=%s&limit=1", appName))
 	if err != nil {
-		return err
+		return false, err
 	}
-	defer dir.Close()
-	fi, err := dir.Stat()
+	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return false, err
 	}
-	header, err := tar.FileInfoHeader(fi, "")
+	response, err := client.Do(request)
 	if err != nil {
-		return err
+		return false, err
 	}
-	header.Name = path
-	err = writer.WriteHeader(header)
+	defer response.Body.Close()
+	if response.StatusCode == http.StatusNoContent {
+		return false, nil
+	}
+	var deploys []tsuruapp.DeployData
+	err = json.NewDecoder(response.Body).Decode(&deploys)
+	if err != nil {
+		return false, err
+	}
+	if len(deploys) == 0 {
+		return false, nil
+	}
+	return deploys[0].Error == "" && deploys[0].Commit == commit, nil
+}
+
+// archiveOptions controls how targz builds the deploy archive.
+type archiveOptions struct {
+	ignore *ignoreList
+	// entries, when set, receives the name of every entry added to the
+	// archive, one per line.
+	entries  io.Writer
+	progress *progressReporter
+	// followSymlinks makes symlinks to be archived as the files and
+	// directories they point to, instead of links.
+	followSymlinks bool
+	// reproducible makes the archive depend only on the names, contents and
+	// modes of the files, sorting entries and zeroing timestamps and
+	// ownership.
+	reproducible bool
+}
+
+// reader wraps the reader of a file being archived, so its content is
+// accounted in the upload progress.
+func (o *archiveOptions) reader(r io.Reader) io.Reader {
+	if o.progress != nil {
+		return o.progress.Reader(r)
+	}
+	return r
+}
+
+func (o *archiveOptions) add(path string) {
+	if o.entries != nil {
+		fmt.Fprintln(o.entries, path)
+	}
+}
+
+// archiveSize returns the sum of the sizes of the regular files that targz
+// would add to the archive.
+func archiveSize(opts archiveOptions, filepaths ...string) int64 {
+	var total int64
+	walkArchive(ioutil.Discard, &opts, filepaths, func(entry archiveEntry) error {
+		if entry.info.Mode().IsRegular() {
+			total += entry.info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB"}
+	value := float64(size)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d %s", size, units[i])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[i])
+}
+
+func targz(ctx *cmd.Context, destination io.Writer, opts archiveOptions, filepaths ...string) error {
+	gzipWriter := gzip.NewWriter(destination)
+	tarWriter := tar.NewWriter(gzipWriter)
+	err := walkArchive(ctx.Stderr, &opts, filepaths, func(entry archiveEntry) error {
+		return addEntry(tarWriter, &opts, entry)
+	})
 	if err != nil {
 		return err
 	}
-	fis, err := dir.Readdir(0)
+	err = tarWriter.Close()
 	if err != nil {
 		return err
 	}
-	for _, fi := range fis {
-		if fi.IsDir() {
-			err = addDir(writer, filepath.Join(path, fi.Name()))
-		} else {
-			err = addFile(writer, filepath.Join(path, fi.Name()))
+	return gzipWriter.Close()
+}
+
+// archiveEntry is a file, directory or symlink to be added to the deploy
+// archive.
+type archiveEntry struct {
+	// path is the location of the entry in the local filesystem.
+	path string
+	// name is the slash separated name of the entry in the archive, which
+	// is relative to the deploy root and doesn't depend on the current
+	// working directory.
+	name string
+	info os.FileInfo
+	// link is the target of the entry when it's stored as a symlink.
+	link string
+}
+
+// walkArchive calls fn for each entry that should be added to the archive
+// built from the given paths, skipping the ones matched by the ignore list.
+// When a single directory is given, it's used as the deploy root, so its
+// content is added to the root of the archive.
+//
+// Symlinks found inside directories are stored as links, unless
+// opts.followSymlinks is set, in which case their targets are added in their
+// place. Paths given explicitly are always followed.
+func walkArchive(stderr io.Writer, opts *archiveOptions, filepaths []string, fn func(archiveEntry) error) error {
+	for _, path := range filepaths {
+		if path == ".." {
+			fmt.Fprintf(stderr, "Warning: skipping %q", path)
+			continue
 		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		name := archiveName(path)
+		if fi.IsDir() && len(filepaths) == 1 {
+			name = "."
+		}
+		err = walkEntry(opts, path, name, fi, nil, fn)
 		if err != nil {
 			return err
 		}
@@ -254,51 +1142,125 @@ func addDir(writer *tar.Writer, path string) error {
 	return nil
 }
 
-func addFile(writer *tar.Writer, path string) error {
-	f, err := os.Open(path)
+// archiveName returns the name used in the archive for a path given in the
+// command line. Paths outside of the current directory are stored using
+// only their base name.
+func archiveName(path string) string {
+	path = filepath.Clean(path)
+	if filepath.IsAbs(path) || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return filepath.Base(path)
+	}
+	return filepath.ToSlash(path)
+}
+
+func walkEntry(opts *archiveOptions, path, name string, fi os.FileInfo, parents []os.FileInfo, fn func(archiveEntry) error) error {
+	entry := archiveEntry{path: path, name: name, info: fi}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if !opts.followSymlinks {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			entry.link = link
+			return fn(entry)
+		}
+		target, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		entry.info = target
+		fi = target
+	}
+	if !fi.IsDir() {
+		return fn(entry)
+	}
+	for _, parent := range parents {
+		if os.SameFile(parent, fi) {
+			return fmt.Errorf("symlink cycle detected: %q points to one of its parent directories", path)
+		}
+	}
+	err := fn(entry)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	fi, err := f.Stat()
+	dir, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	header, err := tar.FileInfoHeader(fi, "")
+	fis, err := dir.Readdir(0)
+	dir.Close()
 	if err != nil {
 		return err
 	}
-	header.Name = path
-	err = writer.WriteHeader(header)
+	if opts.reproducible {
+		sort.Sort(fileInfosByName(fis))
+	}
+	parents = append(parents, fi)
+	for _, child := range fis {
+		childName := pathpkg.Join(name, child.Name())
+		if opts.ignore.Match(childName, child.IsDir()) {
+			continue
+		}
+		err = walkEntry(opts, filepath.Join(path, child.Name()), childName, child, parents, fn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addEntry(writer *tar.Writer, opts *archiveOptions, entry archiveEntry) error {
+	header, err := tar.FileInfoHeader(entry.info, entry.link)
 	if err != nil {
 		return err
 	}
-	n, err := io.Copy(writer, f)
+	header.Name = entry.name
+	if opts.reproducible {
+		header.Uid = 0
+		header.Gid = 0
+		header.Uname = ""
+		header.Gname = ""
+		header.ModTime = time.Unix(0, 0)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+	}
+	err = writer.WriteHeader(header)
 	if err != nil {
 		return err
 	}
-	if n != fi.Size() {
-		return io.ErrShortWrite
+	if entry.info.Mode().IsRegular() {
+		f, err := os.Open(entry.path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		n, err := io.Copy(writer, opts.reader(f))
+		if err != nil {
+			return err
+		}
+		if n != entry.info.Size() {
+			return io.ErrShortWrite
+		}
 	}
+	opts.add(entry.name)
 	return nil
 }
 
-type firstWriter struct {
-	io.Writer
-	once sync.Once
-}
+type fileInfosByName []os.FileInfo
 
-func (w *firstWriter) Write(p []byte) (int, error) {
-	w.once.Do(func() {
-		w.Writer.Write([]byte(" ok\n"))
-	})
-	return w.Writer.Write(p)
-}
+func (l fileInfosByName) Len() int           { return len(l) }
+func (l fileInfosByName) Less(i, j int) bool { return l[i].Name() < l[j].Name() }
+func (l fileInfosByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// rollbackDeploysLimit is the number of deploys looked up when choosing the
+// image of a rollback.
+const rollbackDeploysLimit = 25
 
 type appDeployRollback struct {
 	cmd.GuessingCommand
 	cmd.ConfirmationCommand
-	fs *gnuflag.FlagSet
+	previous bool
+	fs       *gnuflag.FlagSet
 }
 
 func (c *appDeployRollback) Flags() *gnuflag.FlagSet {
@@ -307,17 +1269,24 @@ func (c *appDeployRollback) Flags() *gnuflag.FlagSet {
 			c.GuessingCommand.Flags(),
 			c.ConfirmationCommand.Flags(),
 		)
+		c.fs.BoolVar(&c.previous, "previous", false, "Rollback to the newest image older than the one currently deployed")
 	}
 	return c.fs
 }
 
 func (c *appDeployRollback) Info() *cmd.Info {
-	desc := "Deploys an existing image for an app. You can list available images with `tsuru app-deploy-list`."
+	desc := `Deploys an existing image for an app. You can list available images with
+[[tsuru app-deploy-list]], images that can be used in rollbacks are marked
+with (*).
+
+The [[--previous]] flag rolls the app back to the newest image older than
+the one currently deployed. When no image is given and the command runs in a
+terminal, a menu with the images available for rollback is displayed.`
 	return &cmd.Info{
 		Name:    "app-deploy-rollback",
-		Usage:   "app-deploy-rollback [-a/--app appname] [-y/--assume-yes] <image-name>",
+		Usage:   "app-deploy-rollback [-a/--app appname] [-y/--assume-yes] [--previous] [image-name]",
 		Desc:    desc,
-		MinArgs: 1,
+		MinArgs: 0,
 	}
 }
 
@@ -326,7 +1295,26 @@ func (c *appDeployRollback) Run(context *cmd.Context, client *cmd.Client) error
 	if err != nil {
 		return err
 	}
-	imgName := context.Args[0]
+	var imgName string
+	switch {
+	case len(context.Args) > 0:
+		if c.previous {
+			return errors.New("please provide either an image name or --previous, not both")
+		}
+		imgName = context.Args[0]
+	case c.previous:
+		imgName, err = previousImage(client, appName)
+	case isTerminal(context.Stdin):
+		imgName, err = chooseRollbackImage(context, client, appName)
+	default:
+		return errors.New("please provide the name of the image, or use --previous")
+	}
+	if err != nil {
+		return err
+	}
+	if imgName == "" {
+		return nil
+	}
 	if !c.Confirm(context, fmt.Sprintf("Are you sure you want to rollback app %q to image %q?", appName, imgName)) {
 		return nil
 	}
@@ -357,3 +1345,64 @@ func (c *appDeployRollback) Run(context *cmd.Context, client *cmd.Client) error
 	}
 	return nil
 }
+
+// previousImage returns the newest image that can be used in a rollback and
+// is older than the image of the latest successful deploy of the app.
+func previousImage(client *cmd.Client, appName string) (string, error) {
+	deploys, err := listDeploys(client, appName, 0, rollbackDeploysLimit)
+	if err != nil {
+		return "", err
+	}
+	current := -1
+	for i, deploy := range deploys {
+		if deploy.Error == "" {
+			current = i
+			break
+		}
+	}
+	if current >= 0 {
+		for _, deploy := range deploys[current+1:] {
+			if deploy.CanRollback && deploy.Image != deploys[current].Image {
+				return deploy.Image, nil
+			}
+		}
+	}
+	return "", errors.New("no previous image available for rollback")
+}
+
+// chooseRollbackImage displays a menu with the images available for rollback
+// and returns the one chosen by the user, or an empty string if the user
+// gives up.
+func chooseRollbackImage(context *cmd.Context, client *cmd.Client, appName string) (string, error) {
+	deploys, err := listDeploys(client, appName, 0, rollbackDeploysLimit)
+	if err != nil {
+		return "", err
+	}
+	var candidates []tsuruapp.DeployData
+	seen := make(map[string]bool)
+	for _, deploy := range deploys {
+		if deploy.CanRollback && !seen[deploy.Image] {
+			seen[deploy.Image] = true
+			candidates = append(candidates, deploy)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("no image available for rollback")
+	}
+	fmt.Fprintln(context.Stdout, "Images available for rollback:")
+	for i, deploy := range candidates {
+		timestamp := deploy.Timestamp.Local().Format(time.Stamp)
+		fmt.Fprintf(context.Stdout, "  %d. %s (%s, %s)\n", i+1, deploy.Image, deploy.Origin, timestamp)
+	}
+	fmt.Fprintf(context.Stdout, "Choose an image [1-%d]: ", len(candidates))
+	var answer string
+	if n, err := fmt.Fscanf(context.Stdin, "%s\n", &answer); n != 1 || err != nil {
+		fmt.Fprintln(context.Stdout, "Abort.")
+		return "", nil
+	}
+	choice, err := strconv.Atoi(answer)
+	if err != nil || choice < 1 || choice > len(candidates) {
+		return "", fmt.Errorf("invalid choice %q", answer)
+	}
+	return candidates[choice-1].Image, nil
+}
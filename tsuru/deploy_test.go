@@ -9,14 +9,24 @@ import (
 	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/cmd/cmdtest"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/exec/exectest"
 	tsuruIo "github.com/tsuru/tsuru/io"
 	"gopkg.in/check.v1"
 )
@@ -30,7 +40,7 @@ func (s *S) TestDeployRun(c *check.C) {
 	var called bool
 	var buf bytes.Buffer
 	ctx := cmd.Context{Stderr: bytes.NewBufferString("")}
-	err := targz(&ctx, &buf, "testdata", "..")
+	err := targz(&ctx, &buf, archiveOptions{}, "testdata", "..")
 	c.Assert(err, check.IsNil)
 	trans := cmdtest.ConditionalTransport{
 		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
@@ -60,6 +70,41 @@ func (s *S) TestDeployRun(c *check.C) {
 	c.Assert(called, check.Equals, true)
 }
 
+func (s *S) TestDeployRunStreamsArchive(c *check.C) {
+	var buf bytes.Buffer
+	ctx := cmd.Context{Stderr: bytes.NewBufferString("")}
+	err := targz(&ctx, &buf, archiveOptions{}, "testdata")
+	c.Assert(err, check.IsNil)
+	var contentLength int64
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			defer req.Body.Close()
+			contentLength = req.ContentLength
+			file, header, err := req.FormFile("file")
+			c.Assert(err, check.IsNil)
+			c.Assert(header.Filename, check.Equals, "archive.tar.gz")
+			content, err := ioutil.ReadAll(file)
+			c.Assert(err, check.IsNil)
+			c.Assert(content, check.DeepEquals, buf.Bytes())
+			return req.Method == "POST" && req.URL.Path == "/apps/secret/deploy"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(contentLength, check.Equals, int64(-1))
+	c.Assert(stdout.String(), check.Matches, `(?s)Uploading files\.\.\.\nUploaded \d+ B in 00:00 \(.*/s\)\ndeploy worked\nOK\n`)
+}
+
 func (s *S) TestDeployRunNotOK(c *check.C) {
 	trans := cmdtest.Transport{Message: "deploy worked\n", Status: http.StatusOK}
 	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
@@ -107,11 +152,222 @@ func (s *S) TestDeployRunRequestFailure(c *check.C) {
 	c.Assert(err.Error(), check.Equals, "app not found\n")
 }
 
+func (s *S) TestDeployRunRetriesNetworkFailures(c *check.C) {
+	deployRetryDelay = time.Millisecond
+	defer func() {
+		deployRetryDelay = 2 * time.Second
+	}()
+	var calls int
+	trans := transportFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		defer req.Body.Close()
+		switch calls {
+		case 1:
+			return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+		case 2:
+			return nil, &net.OpError{Op: "write", Net: "tcp", Err: &os.SyscallError{Syscall: "write", Err: syscall.ECONNRESET}}
+		}
+		_, _, err := req.FormFile("file")
+		c.Assert(err, check.IsNil)
+		c.Assert(req.URL.Path, check.Equals, "/apps/secret/deploy")
+		return &http.Response{Body: ioutil.NopCloser(strings.NewReader("deploy worked\nOK\n")), StatusCode: http.StatusOK}, nil
+	})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "secret"}}}
+	err := command.Flags().Parse(true, []string{"--retries", "2"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(calls, check.Equals, 3)
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	c.Assert(lines, check.HasLen, 2)
+	c.Assert(lines[0], check.Matches, `Upload failed: Failed to connect to tsuru server .*\. Retrying in 1ms \(retry 1 of 2\)\.\.\.`)
+	c.Assert(lines[1], check.Matches, `Upload failed: Failed to connect to tsuru server .*\. Retrying in 2ms \(retry 2 of 2\)\.\.\.`)
+	c.Assert(stdout.String(), check.Matches, "(?s).*deploy worked\nOK\n$")
+}
+
+func (s *S) TestDeployRunRetriesExhausted(c *check.C) {
+	deployRetryDelay = time.Millisecond
+	defer func() {
+		deployRetryDelay = 2 * time.Second
+	}()
+	var calls int
+	trans := transportFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		req.Body.Close()
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}
+	})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "secret"}}}
+	err := command.Flags().Parse(true, []string{"--retries", "1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "Failed to connect to tsuru server .*")
+	c.Assert(calls, check.Equals, 2)
+	c.Assert(stderr.String(), check.Matches, `Upload failed: Failed to connect to tsuru server .*\. Retrying in 1ms \(retry 1 of 1\)\.\.\.\n`)
+}
+
+func (s *S) TestDeployRunDoesNotRetryGatewayTimeout(c *check.C) {
+	deployRetryDelay = time.Millisecond
+	defer func() {
+		deployRetryDelay = 2 * time.Second
+	}()
+	var calls int
+	trans := transportFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		ioutil.ReadAll(req.Body)
+		return &http.Response{Body: ioutil.NopCloser(strings.NewReader("gateway timeout")), StatusCode: http.StatusGatewayTimeout}, nil
+	})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "secret"}}}
+	err := command.Flags().Parse(true, []string{"--retries", "2"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "gateway timeout")
+	c.Assert(calls, check.Equals, 1)
+	c.Assert(stderr.String(), check.Equals, "")
+}
+
+func (s *S) TestDeployRunDoesNotRetryPermanentFailures(c *check.C) {
+	deployRetryDelay = time.Millisecond
+	defer func() {
+		deployRetryDelay = 2 * time.Second
+	}()
+	var calls int
+	trans := transportFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		req.Body.Close()
+		return nil, errors.New("x509: certificate signed by unknown authority")
+	})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "secret"}}}
+	err := command.Flags().Parse(true, []string{"--retries", "2"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, ".*x509: certificate signed by unknown authority")
+	c.Assert(calls, check.Equals, 1)
+	c.Assert(stderr.String(), check.Equals, "")
+}
+
+// closeRecorder is a response body that records whether it was closed.
+type closeRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *closeRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func (s *S) TestDeployUploadArchiveFailureClosesResponse(c *check.C) {
+	body := &closeRecorder{Reader: strings.NewReader("deploy worked\nOK\n")}
+	trans := transportFunc(func(req *http.Request) (*http.Response, error) {
+		ioutil.ReadAll(req.Body)
+		return &http.Response{Body: body, StatusCode: http.StatusOK}, nil
+	})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"/tmp/something/that/doesnt/really/exist/im/sure"},
+	}
+	command := appDeploy{}
+	resp, err := command.upload(&context, client, "http://localhost:8080/apps/secret/deploy", archiveOptions{}, "")
+	c.Assert(err, check.NotNil)
+	c.Assert(resp, check.IsNil)
+	c.Assert(body.closed, check.Equals, true)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (s *S) TestIsTransientError(c *check.C) {
+	var tests = []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{&tsuruErrors.HTTP{Code: http.StatusBadGateway}, false},
+		{&tsuruErrors.HTTP{Code: http.StatusGatewayTimeout}, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: &os.SyscallError{Syscall: "connect", Err: syscall.ECONNREFUSED}}, true},
+		{&url.Error{Op: "Post", URL: "http://tsuru", Err: &net.OpError{Op: "dial", Net: "tcp", Err: timeoutError{}}}, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: &os.SyscallError{Syscall: "write", Err: syscall.ECONNRESET}}, true},
+		{&net.OpError{Op: "write", Net: "tcp", Err: &os.SyscallError{Syscall: "write", Err: syscall.EPIPE}}, true},
+		{&net.OpError{Op: "read", Net: "tcp", Err: &os.SyscallError{Syscall: "read", Err: syscall.ECONNRESET}}, false},
+		{&net.OpError{Op: "read", Net: "tcp", Err: timeoutError{}}, false},
+		{&url.Error{Op: "Post", URL: "http://tsuru", Err: io.EOF}, false},
+		{&url.Error{Op: "Post", URL: "http://tsuru", Err: timeoutError{}}, false},
+		{&url.Error{Op: "Post", URL: "http://tsuru", Err: errors.New("net/http: request canceled")}, false},
+		{&url.Error{Op: "parse", URL: "::", Err: errors.New("missing protocol scheme")}, false},
+		{errors.New("x509: certificate signed by unknown authority"), false},
+	}
+	for _, t := range tests {
+		c.Check(isTransientError(t.err), check.Equals, t.transient, check.Commentf("%#v", t.err))
+	}
+}
+
+func (s *S) TestDeployRunDoesNotRetryDeployFailures(c *check.C) {
+	deployRetryDelay = time.Millisecond
+	defer func() {
+		deployRetryDelay = 2 * time.Second
+	}()
+	var calls int
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy failed\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			calls++
+			return true
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "secret"}}}
+	command.Flags()
+	err := command.Run(&context, client)
+	c.Assert(err, check.Equals, cmd.ErrAbortCommand)
+	c.Assert(calls, check.Equals, 1)
+	c.Assert(stderr.String(), check.Equals, "")
+}
+
 func (s *S) TestTargz(c *check.C) {
 	var buf bytes.Buffer
 	ctx := cmd.Context{Stderr: &buf}
 	var gzipBuf, tarBuf bytes.Buffer
-	err := targz(&ctx, &gzipBuf, "testdata", "..")
+	err := targz(&ctx, &gzipBuf, archiveOptions{}, "testdata", "..")
 	c.Assert(err, check.IsNil)
 	gzipReader, err := gzip.NewReader(&gzipBuf)
 	c.Assert(err, check.IsNil)
@@ -146,7 +402,7 @@ func (s *S) TestTargzSingleDirectory(c *check.C) {
 	var buf bytes.Buffer
 	ctx := cmd.Context{Stderr: &buf}
 	var gzipBuf, tarBuf bytes.Buffer
-	err := targz(&ctx, &gzipBuf, "testdata")
+	err := targz(&ctx, &gzipBuf, archiveOptions{}, "testdata")
 	c.Assert(err, check.IsNil)
 	gzipReader, err := gzip.NewReader(&gzipBuf)
 	c.Assert(err, check.IsNil)
@@ -177,11 +433,658 @@ func (s *S) TestTargzFailure(c *check.C) {
 	var stderr bytes.Buffer
 	ctx := cmd.Context{Stderr: &stderr}
 	var buf bytes.Buffer
-	err := targz(&ctx, &buf, "/tmp/something/that/definitely/doesnt/exist/right", "testdata")
+	err := targz(&ctx, &buf, archiveOptions{}, "/tmp/something/that/definitely/doesnt/exist/right", "testdata")
 	c.Assert(err, check.NotNil)
 	c.Assert(err.Error(), check.Equals, "stat /tmp/something/that/definitely/doesnt/exist/right: no such file or directory")
 }
 
+func (s *S) TestTargzIgnoreList(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.MkdirAll(filepath.Join(dir, "node_modules", "lib"), 0755), check.IsNil)
+	c.Assert(os.MkdirAll(filepath.Join(dir, "logs"), 0755), check.IsNil)
+	files := map[string]string{
+		".tsuruignore":              "node_modules/\n*.log\n!keep.log\n",
+		"app.py":                    "app",
+		"node_modules/lib/index.js": "lib",
+		"logs/app.log":              "log",
+		"logs/keep.log":             "keep",
+	}
+	for name, content := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644), check.IsNil)
+	}
+	var command appDeploy
+	ignore, err := command.ignoreList([]string{dir})
+	c.Assert(err, check.IsNil)
+	var gzipBuf, stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	err = targz(&ctx, &gzipBuf, archiveOptions{ignore: ignore}, dir)
+	c.Assert(err, check.IsNil)
+	gzipReader, err := gzip.NewReader(&gzipBuf)
+	c.Assert(err, check.IsNil)
+	tarReader := tar.NewReader(gzipReader)
+	var headers []string
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		headers = append(headers, header.Name)
+	}
+	expected := []string{".", ".tsuruignore", "app.py", "logs", "logs/keep.log"}
+	sort.Strings(headers)
+	c.Assert(headers, check.DeepEquals, expected)
+}
+
+func readTarHeaders(c *check.C, gzipBuf io.Reader) map[string]*tar.Header {
+	gzipReader, err := gzip.NewReader(gzipBuf)
+	c.Assert(err, check.IsNil)
+	tarReader := tar.NewReader(gzipReader)
+	headers := make(map[string]*tar.Header)
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		headers[header.Name] = header
+	}
+	return headers
+}
+
+func (s *S) TestTargzSymlinks(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "static"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "static", "index.html"), []byte("hello"), 0644), check.IsNil)
+	c.Assert(os.Symlink("static/index.html", filepath.Join(dir, "index.html")), check.IsNil)
+	c.Assert(os.Symlink("static", filepath.Join(dir, "public")), check.IsNil)
+	var gzipBuf, stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	err := targz(&ctx, &gzipBuf, archiveOptions{}, dir)
+	c.Assert(err, check.IsNil)
+	headers := readTarHeaders(c, &gzipBuf)
+	c.Assert(headers, check.HasLen, 5)
+	c.Assert(headers["index.html"].Typeflag, check.Equals, byte(tar.TypeSymlink))
+	c.Assert(headers["index.html"].Linkname, check.Equals, "static/index.html")
+	c.Assert(headers["public"].Typeflag, check.Equals, byte(tar.TypeSymlink))
+	c.Assert(headers["public"].Linkname, check.Equals, "static")
+}
+
+func (s *S) TestTargzFollowSymlinks(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "static"), 0755), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "static", "index.html"), []byte("hello"), 0644), check.IsNil)
+	c.Assert(os.Symlink("static/index.html", filepath.Join(dir, "index.html")), check.IsNil)
+	c.Assert(os.Symlink("static", filepath.Join(dir, "public")), check.IsNil)
+	var gzipBuf, stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	err := targz(&ctx, &gzipBuf, archiveOptions{followSymlinks: true}, dir)
+	c.Assert(err, check.IsNil)
+	headers := readTarHeaders(c, &gzipBuf)
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	c.Assert(names, check.DeepEquals, []string{".", "index.html", "public", "public/index.html", "static", "static/index.html"})
+	c.Assert(headers["index.html"].Typeflag, check.Equals, byte(tar.TypeReg))
+	c.Assert(headers["index.html"].Size, check.Equals, int64(5))
+	c.Assert(headers["public"].Typeflag, check.Equals, byte(tar.TypeDir))
+}
+
+func (s *S) TestTargzFollowSymlinksCycle(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "sub"), 0755), check.IsNil)
+	c.Assert(os.Symlink("..", filepath.Join(dir, "sub", "loop")), check.IsNil)
+	var gzipBuf, stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	err := targz(&ctx, &gzipBuf, archiveOptions{followSymlinks: true}, dir)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, fmt.Sprintf("symlink cycle detected: %q points to one of its parent directories", filepath.Join(dir, "sub", "loop")))
+	gzipBuf.Reset()
+	err = targz(&ctx, &gzipBuf, archiveOptions{}, dir)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTargzPreservesModeAndModTime(c *check.C) {
+	dir := c.MkDir()
+	script := filepath.Join(dir, "run.sh")
+	c.Assert(ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755), check.IsNil)
+	mtime := time.Date(2015, 3, 10, 12, 30, 0, 0, time.UTC)
+	c.Assert(os.Chtimes(script, mtime, mtime), check.IsNil)
+	var gzipBuf, stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	err := targz(&ctx, &gzipBuf, archiveOptions{}, dir)
+	c.Assert(err, check.IsNil)
+	headers := readTarHeaders(c, &gzipBuf)
+	c.Assert(headers["run.sh"].Mode&0777, check.Equals, int64(0755))
+	c.Assert(headers["run.sh"].ModTime.Equal(mtime), check.Equals, true)
+}
+
+func (s *S) TestTargzNamesDontDependOnWorkingDirectory(c *check.C) {
+	abs, err := filepath.Abs("testdata")
+	c.Assert(err, check.IsNil)
+	var stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr}
+	var relBuf, absBuf bytes.Buffer
+	err = targz(&ctx, &relBuf, archiveOptions{}, "testdata")
+	c.Assert(err, check.IsNil)
+	err = targz(&ctx, &absBuf, archiveOptions{}, abs)
+	c.Assert(err, check.IsNil)
+	relHeaders := readTarHeaders(c, &relBuf)
+	absHeaders := readTarHeaders(c, &absBuf)
+	c.Assert(absHeaders, check.HasLen, len(relHeaders))
+	for name := range relHeaders {
+		c.Check(absHeaders[name], check.NotNil, check.Commentf("missing %q", name))
+	}
+	absBuf.Reset()
+	err = targz(&ctx, &absBuf, archiveOptions{}, filepath.Join(abs, "file1.txt"), "testdata/./file2.txt")
+	c.Assert(err, check.IsNil)
+	absHeaders = readTarHeaders(c, &absBuf)
+	c.Assert(absHeaders["file1.txt"], check.NotNil)
+	c.Assert(absHeaders["testdata/file2.txt"], check.NotNil)
+}
+
+func (s *S) TestTargzReproducible(c *check.C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "lib"), 0755), check.IsNil)
+	files := []string{"b.txt", "a.txt", "lib/c.txt"}
+	for _, name := range files {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), []byte(name), 0644), check.IsNil)
+	}
+	var stderr bytes.Buffer
+	ctx := cmd.Context{Stderr: &stderr, Args: []string{dir}}
+	opts := archiveOptions{reproducible: true}
+	first, err := archiveHash(&ctx, opts)
+	c.Assert(err, check.IsNil)
+	mtime := time.Date(2015, 3, 10, 12, 30, 0, 0, time.UTC)
+	for _, name := range files {
+		c.Assert(os.Chtimes(filepath.Join(dir, name), mtime, mtime), check.IsNil)
+	}
+	second, err := archiveHash(&ctx, opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(second, check.Equals, first)
+	c.Assert(first, check.HasLen, 64)
+	var gzipBuf bytes.Buffer
+	err = targz(&ctx, &gzipBuf, opts, dir)
+	c.Assert(err, check.IsNil)
+	gzipReader, err := gzip.NewReader(&gzipBuf)
+	c.Assert(err, check.IsNil)
+	tarReader := tar.NewReader(gzipReader)
+	var names []string
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		names = append(names, header.Name)
+		c.Check(header.ModTime.Unix(), check.Equals, int64(0))
+		c.Check(header.Uid, check.Equals, 0)
+		c.Check(header.Gid, check.Equals, 0)
+	}
+	c.Assert(names, check.DeepEquals, []string{".", "a.txt", "b.txt", "lib", "lib/c.txt"})
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte("changed"), 0644), check.IsNil)
+	third, err := archiveHash(&ctx, opts)
+	c.Assert(err, check.IsNil)
+	c.Assert(third, check.Not(check.Equals), first)
+}
+
+func (s *S) TestDeployRunSkipUnchanged(c *check.C) {
+	ctx := cmd.Context{Stderr: bytes.NewBufferString(""), Args: []string{"testdata"}}
+	hash, err := archiveHash(&ctx, archiveOptions{reproducible: true})
+	c.Assert(err, check.IsNil)
+	deploys := fmt.Sprintf(`[{"ID": "123", "App": "secret", "Commit": "sha256:%s", "Origin": "app-deploy"}]`, hash)
+	var deployCalled bool
+	trans := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: deploys, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && req.URL.Path == "/deploys" &&
+						req.URL.Query().Get("app") == "secret" && req.URL.Query().Get("limit") == "1"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					deployCalled = true
+					return req.URL.Path == "/apps/secret/deploy"
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err = command.Flags().Parse(true, []string{"--skip-unchanged"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(deployCalled, check.Equals, false)
+	expected := "Archive SHA-256: " + hash + "\nNothing changed since the latest deploy, skipping it.\n"
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestDeployRunSkipUnchangedDeploysChanges(c *check.C) {
+	ctx := cmd.Context{Stderr: bytes.NewBufferString(""), Args: []string{"testdata"}}
+	hash, err := archiveHash(&ctx, archiveOptions{reproducible: true})
+	c.Assert(err, check.IsNil)
+	var commit string
+	trans := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: `[{"ID": "123", "App": "secret", "Commit": "sha256:abc"}]`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && req.URL.Path == "/deploys"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					defer req.Body.Close()
+					commit = req.FormValue("commit")
+					return req.Method == "POST" && req.URL.Path == "/apps/secret/deploy"
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err = command.Flags().Parse(true, []string{"--skip-unchanged"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(commit, check.Equals, "sha256:"+hash)
+	c.Assert(stdout.String(), check.Matches, `(?s)Archive SHA-256: `+hash+`\n.*deploy worked\nOK\n`)
+}
+
+func (s *S) TestDeployRunGitRef(c *check.C) {
+	commit := "5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a"
+	fexec := exectest.FakeExecutor{
+		Output: map[string][][]byte{
+			"rev-parse --verify v1.0^{commit}": {[]byte(commit + "\n")},
+			"archive --format=tar " + commit:   {gitArchive(c, map[string]string{"app.py": "app", "Procfile": "web: app.py"})},
+		},
+	}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	var recordedCommit string
+	var names []string
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			defer req.Body.Close()
+			recordedCommit = req.FormValue("commit")
+			file, _, err := req.FormFile("file")
+			c.Assert(err, check.IsNil)
+			names = readTarNames(c, file)
+			return req.Method == "POST" && req.URL.Path == "/apps/secret/deploy"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--ref", "v1.0"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(recordedCommit, check.Equals, commit)
+	c.Assert(names, check.DeepEquals, []string{".", "Procfile", "app.py"})
+	c.Assert(stdout.String(), check.Matches, `(?s)Deploying commit `+commit+`\n.*deploy worked\nOK\n`)
+}
+
+func (s *S) TestDeployRunGitRefDryRun(c *check.C) {
+	commit := "5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a"
+	fexec := exectest.FakeExecutor{
+		Output: map[string][][]byte{
+			"rev-parse --verify v1.0^{commit}": {[]byte(commit + "\n")},
+			"archive --format=tar " + commit:   {gitArchive(c, map[string]string{"app.py": "app"})},
+		},
+	}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	command := appDeploy{}
+	err := command.Flags().Parse(true, []string{"--ref", "v1.0", "--dry-run"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, `Commit that would be deployed: `+commit+`
+Files that would be deployed:
+(?s).*app\.py
+Archive size: \d+ B
+`)
+	c.Assert(strings.Contains(stdout.String(), "Deploying commit"), check.Equals, false)
+}
+
+func (s *S) TestDeployRunGitRefWithFiles(c *check.C) {
+	context := cmd.Context{Args: []string{"testdata"}}
+	command := appDeploy{}
+	err := command.Flags().Parse(true, []string{"--ref", "v1.0"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "files and directories can't be deployed along with --git or --ref")
+}
+
+func (s *S) TestDeployRunWithoutFiles(c *check.C) {
+	var command appDeploy
+	err := command.Run(&cmd.Context{}, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "you must provide at least one file or directory to deploy, or a git ref with --ref")
+}
+
+func readTarNames(c *check.C, r io.Reader) []string {
+	gzipReader, err := gzip.NewReader(r)
+	c.Assert(err, check.IsNil)
+	tarReader := tar.NewReader(gzipReader)
+	var names []string
+	for header, err := tarReader.Next(); err == nil; header, err = tarReader.Next() {
+		names = append(names, header.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *S) TestDeployRunImage(c *check.C) {
+	var image, origin string
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			image = req.FormValue("image")
+			origin = req.URL.Query().Get("origin")
+			return req.Method == "POST" && req.URL.Path == "/apps/secret/deploy"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "registry.example.com/secret:v1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(image, check.Equals, "registry.example.com/secret:v1")
+	c.Assert(origin, check.Equals, "image")
+	c.Assert(stdout.String(), check.Equals, "deploy worked\nOK\n")
+}
+
+func (s *S) TestDeployRunImageDryRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	command := appDeploy{}
+	err := command.Flags().Parse(true, []string{"--image", "registry.example.com/secret:v1", "--dry-run"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "Image that would be deployed: registry.example.com/secret:v1\n")
+}
+
+func (s *S) TestDeployRunImageNotOK(c *check.C) {
+	trans := cmdtest.Transport{Message: "image not found\n", Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "registry.example.com/secret:v1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.Equals, cmd.ErrAbortCommand)
+	c.Assert(stdout.String(), check.Equals, "image not found\n")
+}
+
+func (s *S) TestDeployRunImageWithFiles(c *check.C) {
+	context := cmd.Context{Args: []string{"testdata"}}
+	command := appDeploy{}
+	err := command.Flags().Parse(true, []string{"--image", "registry.example.com/secret:v1"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "files, directories and git refs can't be deployed along with --image")
+}
+
+func waitTransport(deployOutput string, apps ...string) *cmdtest.MultiConditionalTransport {
+	transports := []cmdtest.ConditionalTransport{
+		{
+			Transport: cmdtest.Transport{Message: deployOutput, Status: http.StatusOK},
+			CondFunc: func(req *http.Request) bool {
+				return req.Method == "POST" && req.URL.Path == "/apps/secret/deploy"
+			},
+		},
+	}
+	for _, a := range apps {
+		transports = append(transports, cmdtest.ConditionalTransport{
+			Transport: cmdtest.Transport{Message: a, Status: http.StatusOK},
+			CondFunc: func(req *http.Request) bool {
+				return req.Method == "GET" && req.URL.Path == "/apps/secret"
+			},
+		})
+	}
+	return &cmdtest.MultiConditionalTransport{ConditionalTransports: transports}
+}
+
+func (s *S) TestDeployRunWait(c *check.C) {
+	deployWaitInterval = time.Millisecond
+	defer func() {
+		deployWaitInterval = 2 * time.Second
+	}()
+	trans := waitTransport("deploy worked\nOK\n",
+		`{"name": "secret", "units": [{"Name": "abc", "Status": "started"}, {"Name": "def", "Status": "starting"}]}`,
+		`{"name": "secret", "units": [{"Name": "abc", "Status": "started"}, {"Name": "def", "Status": "started"}]}`,
+	)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "secret:v1", "--wait"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "deploy worked\nOK\nWaiting for units to start...\nAll units started.\n")
+}
+
+func (s *S) TestDeployRunWaitTimeout(c *check.C) {
+	deployWaitInterval = time.Millisecond
+	defer func() {
+		deployWaitInterval = 2 * time.Second
+	}()
+	trans := waitTransport("deploy worked\nOK\n",
+		`{"name": "secret", "units": [{"Name": "abc", "Status": "started"}, {"Name": "def", "Status": "starting"}]}`,
+	)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "secret:v1", "--wait", "--timeout", "1ns"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `timed out after 1ns waiting for the units of app "secret" to start`)
+	expected := `deploy worked
+OK
+Waiting for units to start...
++------+----------+
+| Unit | Status   |
++------+----------+
+| abc  | started  |
+| def  | starting |
++------+----------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestDeployRunWaitCrashingUnits(c *check.C) {
+	deployWaitInterval = time.Millisecond
+	defer func() {
+		deployWaitInterval = 2 * time.Second
+	}()
+	failing := `{"name": "secret", "units": [{"Name": "abc", "Status": "started"}, {"Name": "def", "Status": "error"}]}`
+	trans := waitTransport("deploy worked\nOK\n", failing, failing, failing)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "secret:v1", "--wait"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "units keep failing after the deploy: def")
+	c.Assert(stdout.String(), check.Matches, `(?s).*\| def  \| error   \|.*`)
+}
+
+func (s *S) TestDeployRunWaitUnitRecovers(c *check.C) {
+	deployWaitInterval = time.Millisecond
+	defer func() {
+		deployWaitInterval = 2 * time.Second
+	}()
+	failing := `{"name": "secret", "units": [{"Name": "abc", "Status": "error"}]}`
+	starting := `{"name": "secret", "units": [{"Name": "abc", "Status": "starting"}]}`
+	started := `{"name": "secret", "units": [{"Name": "abc", "Status": "started"}]}`
+	trans := waitTransport("deploy worked\nOK\n", failing, failing, starting, failing, failing, started)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "secret:v1", "--wait"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "deploy worked\nOK\nWaiting for units to start...\nAll units started.\n")
+}
+
+func (s *S) TestDeployRunWaitWithoutUnits(c *check.C) {
+	trans := waitTransport("deploy worked\nOK\n", `{"name": "secret", "units": []}`)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--image", "secret:v1", "--wait"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "deploy worked\nOK\nWaiting for units to start...\nThe app has no units, nothing to wait for.\n")
+}
+
+func (s *S) TestDeployRunHooks(c *check.C) {
+	dir := c.MkDir()
+	project := "client-hooks:\n  pre-deploy:\n    - make assets\n  post-deploy:\n    - ./notify.sh\n"
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "tsuru.yaml"), []byte(project), 0644), check.IsNil)
+	fexec := exectest.FakeExecutor{}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	trans := cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr, Args: []string{dir}}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	commands := fexec.GetCommands("/bin/sh")
+	c.Assert(commands, check.HasLen, 2)
+	c.Assert(commands[0].GetArgs(), check.DeepEquals, []string{"-c", "make assets"})
+	c.Assert(commands[0].GetDir(), check.Equals, dir)
+	c.Assert(commands[1].GetArgs(), check.DeepEquals, []string{"-c", "./notify.sh"})
+	c.Assert(stdout.String(), check.Matches, `(?s)Running pre-deploy hook: make assets\n.*deploy worked\nOK\nRunning post-deploy hook: \./notify\.sh\n`)
+}
+
+func (s *S) TestDeployRunPreHookFailure(c *check.C) {
+	dir := c.MkDir()
+	project := "client-hooks:\n  pre-deploy:\n    - make test\n"
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, "tsuru.yaml"), []byte(project), 0644), check.IsNil)
+	execut = &exectest.ErrorExecutor{}
+	defer func() {
+		execut = nil
+	}()
+	var called bool
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			called = true
+			return true
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr, Args: []string{dir}}
+	fake := cmdtest.FakeGuesser{Name: "secret"}
+	command := appDeploy{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `pre-deploy hook "make test" failed: .*`)
+	c.Assert(called, check.Equals, false)
+}
+
+func (s *S) TestDeployIgnoreFileFlag(c *check.C) {
+	dir := c.MkDir()
+	ignoreFile := filepath.Join(dir, "deploy-ignore")
+	c.Assert(ioutil.WriteFile(ignoreFile, []byte("*.txt\n"), 0644), check.IsNil)
+	var command appDeploy
+	err := command.Flags().Parse(true, []string{"--ignore-file", ignoreFile})
+	c.Assert(err, check.IsNil)
+	ignore, err := command.ignoreList([]string{"testdata"})
+	c.Assert(err, check.IsNil)
+	c.Assert(ignore.Match("file1.txt", false), check.Equals, true)
+}
+
+func (s *S) TestDeployIgnoreFileFlagNotFound(c *check.C) {
+	var command appDeploy
+	err := command.Flags().Parse(true, []string{"--ignore-file", "/tmp/something/that/doesnt/really/exist"})
+	c.Assert(err, check.IsNil)
+	_, err = command.ignoreList([]string{"testdata"})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestDeployDryRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"testdata"},
+	}
+	command := appDeploy{}
+	err := command.Flags().Parse(true, []string{"--dry-run"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	c.Assert(lines, check.HasLen, 7)
+	c.Assert(lines[0], check.Equals, "Files that would be deployed:")
+	files := lines[1:6]
+	sort.Strings(files)
+	c.Assert(files, check.DeepEquals, []string{".", "directory", "directory/file.txt", "file1.txt", "file2.txt"})
+	c.Assert(lines[6], check.Matches, `Archive size: \d+ B`)
+}
+
+func (s *S) TestArchiveSize(c *check.C) {
+	c.Assert(archiveSize(archiveOptions{}, "testdata"), check.Equals, int64(29))
+	c.Assert(archiveSize(archiveOptions{}, "testdata/file1.txt", ".."), check.Equals, int64(19))
+	ignore, err := parseIgnoreList(strings.NewReader("directory/\n"))
+	c.Assert(err, check.IsNil)
+	c.Assert(archiveSize(archiveOptions{ignore: ignore}, "testdata"), check.Equals, int64(25))
+}
+
+func (s *S) TestFormatSize(c *check.C) {
+	c.Assert(formatSize(512), check.Equals, "512 B")
+	c.Assert(formatSize(1536), check.Equals, "1.5 KB")
+	c.Assert(formatSize(10*1024*1024), check.Equals, "10.0 MB")
+	c.Assert(formatSize(3*1024*1024*1024), check.Equals, "3.0 GB")
+}
+
 func (s *S) TestDeployListInfo(c *check.C) {
 	var cmd appDeployList
 	c.Assert(cmd.Info(), check.NotNil)
@@ -262,6 +1165,111 @@ func (s *S) TestAppDeployList(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestAppDeployListPagination(c *check.C) {
+	var query string
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "", Status: http.StatusNoContent},
+		CondFunc: func(req *http.Request) bool {
+			query = req.URL.RawQuery
+			return req.URL.Path == "/deploys"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "test"}
+	command := appDeployList{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--limit", "5", "--page", "3"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(query, check.Equals, "app=test&limit=5&skip=10")
+	c.Assert(stdout.String(), check.Equals, "")
+}
+
+func (s *S) TestAppDeployListSkipAndPage(c *check.C) {
+	command := appDeployList{}
+	err := command.Flags().Parse(true, []string{"--skip", "5", "--page", "3"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{}, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "please use only one of --skip and --page")
+}
+
+func (s *S) TestAppDeployListInvalidDate(c *check.C) {
+	command := appDeployList{}
+	err := command.Flags().Parse(true, []string{"--since", "yesterday"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{}, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `invalid date "yesterday", use YYYY-MM-DD, RFC 3339 or a duration like 24h`)
+}
+
+func (s *S) TestAppDeployListFiltersJSON(c *check.C) {
+	page1 := `[
+  {"ID": "5", "App": "test", "Timestamp": "2015-01-28T18:00:00Z", "User": "a@example.com", "Origin": "git"},
+  {"ID": "4", "App": "test", "Timestamp": "2015-01-27T18:00:00Z", "User": "b@example.com", "Origin": "git", "Error": "failed"}
+]`
+	page2 := `[
+  {"ID": "3", "App": "test", "Timestamp": "2015-01-26T18:00:00Z", "User": "a@example.com", "Origin": "app-deploy", "Error": "failed"},
+  {"ID": "2", "App": "test", "Timestamp": "2015-01-25T18:00:00Z", "User": "a@example.com", "Origin": "git", "Error": "failed"}
+]`
+	page3 := `[
+  {"ID": "1", "App": "test", "Timestamp": "2015-01-10T18:00:00Z", "User": "a@example.com", "Origin": "git", "Error": "failed"}
+]`
+	var queries []string
+	cond := func(req *http.Request) bool {
+		queries = append(queries, req.URL.RawQuery)
+		return req.URL.Path == "/deploys"
+	}
+	trans := cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{Transport: cmdtest.Transport{Message: page1, Status: http.StatusOK}, CondFunc: cond},
+			{Transport: cmdtest.Transport{Message: page2, Status: http.StatusOK}, CondFunc: cond},
+			{Transport: cmdtest.Transport{Message: page3, Status: http.StatusOK}, CondFunc: cond},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	fake := cmdtest.FakeGuesser{Name: "test"}
+	command := appDeployList{GuessingCommand: cmd.GuessingCommand{G: &fake}}
+	err := command.Flags().Parse(true, []string{"--limit", "2", "--user", "a@example.com", "--failed-only", "--since", "2015-01-20T00:00:00Z", "--json"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(queries, check.DeepEquals, []string{"app=test&limit=2", "app=test&limit=2&skip=2"})
+	var deploys []map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &deploys)
+	c.Assert(err, check.IsNil)
+	c.Assert(deploys, check.HasLen, 2)
+	c.Assert(deploys[0]["ID"], check.Equals, "3")
+	c.Assert(deploys[1]["ID"], check.Equals, "2")
+}
+
+func (s *S) TestAppDeployListOrigins(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[
+  {"ID": "1", "App": "test", "Commit": "54c92d91a46ec0e78501d86b", "Image": "tsuru/app-test:v2", "Origin": "app-deploy"},
+  {"ID": "2", "App": "test", "Commit": "sha256:0123456789abcdef", "Image": "tsuru/app-test:v1", "Origin": "app-deploy"},
+  {"ID": "3", "App": "test", "Image": "registry.example.com/test:v1", "Origin": "image"},
+  {"ID": "4", "App": "test", "Commit": "sha256:fedcba9876543210", "Image": "tsuru/app-test:v0", "Origin": "git"}
+]`
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := appDeployList{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	lines := strings.Split(stdout.String(), "\n")
+	c.Assert(lines[3], check.Matches, `\| tsuru/app-test:v2 +\| git \(54c92d9\) +\|.*`)
+	c.Assert(lines[5], check.Matches, `\| tsuru/app-test:v1 +\| app-deploy \(sha256:0123456\) +\|.*`)
+	c.Assert(lines[7], check.Matches, `\| registry.example.com/test:v1 +\| image +\|.*`)
+	c.Assert(lines[9], check.Matches, `\| tsuru/app-test:v0 +\| git \(sha256:fedcba9\) +\|.*`)
+}
+
 func (s *S) TestAppDeployRollbackInfo(c *check.C) {
 	c.Assert((&appDeployRollback{}).Info(), check.NotNil)
 }
@@ -297,3 +1305,190 @@ func (s *S) TestAppDeployRollback(c *check.C) {
 	c.Assert(called, check.Equals, true)
 	c.Assert(stdout.String(), check.Equals, expectedOut)
 }
+
+var rollbackDeploys = `[
+  {"ID": "4", "App": "arrakis", "Image": "tsuru/app-arrakis:v4", "Origin": "git", "Error": "failed", "CanRollback": false},
+  {"ID": "3", "App": "arrakis", "Image": "tsuru/app-arrakis:v3", "Origin": "git", "CanRollback": true},
+  {"ID": "2", "App": "arrakis", "Image": "tsuru/app-arrakis:v3", "Origin": "rollback", "CanRollback": true},
+  {"ID": "1", "App": "arrakis", "Image": "tsuru/app-arrakis:v2", "Origin": "app-deploy", "CanRollback": true}
+]`
+
+func rollbackTransport(c *check.C, image string) *cmdtest.MultiConditionalTransport {
+	msg, err := json.Marshal(tsuruIo.SimpleJsonMessage{Message: "-- deployed --"})
+	c.Assert(err, check.IsNil)
+	return &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: rollbackDeploys, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && req.URL.Path == "/deploys" && req.URL.Query().Get("app") == "arrakis"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(msg), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					body, _ := ioutil.ReadAll(req.Body)
+					return req.URL.Path == "/apps/arrakis/deploy/rollback" &&
+						req.Method == "POST" && string(body) == "image="+image
+				},
+			},
+		},
+	}
+}
+
+func (s *S) TestAppDeployRollbackPrevious(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: rollbackTransport(c, "tsuru/app-arrakis:v2")}, nil, manager)
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis", "-y", "--previous"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "-- deployed --")
+}
+
+func (s *S) TestAppDeployRollbackPreviousNotAvailable(c *check.C) {
+	deploys := `[{"ID": "1", "App": "arrakis", "Image": "tsuru/app-arrakis:v1", "Origin": "git", "CanRollback": true}]`
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: deploys, Status: http.StatusOK}}, nil, manager)
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis", "-y", "--previous"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{}, client)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "no previous image available for rollback")
+}
+
+func (s *S) TestAppDeployRollbackPreviousWithImage(c *check.C) {
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis", "--previous"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Args: []string{"my-image"}}, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "please provide either an image name or --previous, not both")
+}
+
+func (s *S) TestAppDeployRollbackWithoutImage(c *check.C) {
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&cmd.Context{Stdin: strings.NewReader("")}, nil)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "please provide the name of the image, or use --previous")
+}
+
+func (s *S) TestAppDeployRollbackMenu(c *check.C) {
+	oldIsTerminal := isTerminal
+	isTerminal = func(interface{}) bool { return true }
+	defer func() {
+		isTerminal = oldIsTerminal
+	}()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("2\ny\n"),
+	}
+	client := cmd.NewClient(&http.Client{Transport: rollbackTransport(c, "tsuru/app-arrakis:v2")}, nil, manager)
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, `Images available for rollback:
+  1\. tsuru/app-arrakis:v3 \(git, .*\)
+  2\. tsuru/app-arrakis:v2 \(app-deploy, .*\)
+Choose an image \[1-2\]: Are you sure you want to rollback app "arrakis" to image "tsuru/app-arrakis:v2"\? \(y/n\) -- deployed --`)
+}
+
+func (s *S) TestAppDeployRollbackMenuInvalidChoice(c *check.C) {
+	oldIsTerminal := isTerminal
+	isTerminal = func(interface{}) bool { return true }
+	defer func() {
+		isTerminal = oldIsTerminal
+	}()
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stdin: strings.NewReader("7\n")}
+	client := cmd.NewClient(&http.Client{Transport: rollbackTransport(c, "")}, nil, manager)
+	command := appDeployRollback{}
+	err := command.Flags().Parse(true, []string{"--app", "arrakis"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `invalid choice "7"`)
+}
+
+func (s *S) TestAppDeployInfoInfo(c *check.C) {
+	var command appDeployInfo
+	c.Assert(command.Info(), check.NotNil)
+}
+
+func (s *S) TestAppDeployInfo(c *check.C) {
+	result := `{
+  "ID": "54c92d91a46ec0e78501d86b",
+  "App": "test",
+  "Timestamp": "2015-01-28T18:42:25.725Z",
+  "Duration": 18709653486,
+  "Commit": "54c92d91a46ec0e78501d86b54c92d91a46ec0e78501d86b",
+  "Error": "",
+  "Image": "tsuru/app-test:v3",
+  "User": "admin@example.com",
+  "Origin": "git",
+  "CanRollback": true,
+  "Log": "Building image...\nOK"
+}`
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: result, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			return req.Method == "GET" && req.URL.Path == "/deploys/54c92d91a46ec0e78501d86b"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"54c92d91a46ec0e78501d86b"},
+	}
+	command := appDeployInfo{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	timestamp, _ := time.Parse(time.RFC3339, "2015-01-28T18:42:25.725Z")
+	expected := `ID: 54c92d91a46ec0e78501d86b
+App: test
+Image: tsuru/app-test:v3
+Origin: git
+Commit: 54c92d91a46ec0e78501d86b54c92d91a46ec0e78501d86b
+User: admin@example.com
+Date: ` + timestamp.Local().Format(time.Stamp) + `
+Duration: 00:18
+Can rollback: yes
+
+Log:
+Building image...
+OK
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppDeployInfoJSON(c *check.C) {
+	result := `{"ID": "123", "App": "test", "Error": "deploy failed", "Log": "Building image...\n"}`
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Args:   []string{"123"},
+	}
+	command := appDeployInfo{}
+	err := command.Flags().Parse(true, []string{"--json"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	var deploy map[string]interface{}
+	err = json.Unmarshal(stdout.Bytes(), &deploy)
+	c.Assert(err, check.IsNil)
+	c.Assert(deploy["ID"], check.Equals, "123")
+	c.Assert(deploy["Error"], check.Equals, "deploy failed")
+	c.Assert(deploy["Log"], check.Equals, "Building image...\n")
+}
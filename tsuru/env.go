@@ -18,6 +18,7 @@ import (
 
 	"github.com/tsuru/tsuru/cmd"
 	tsuruIo "github.com/tsuru/tsuru/io"
+	"launchpad.net/gnuflag"
 )
 
 const envSetValidationMessage = `You must specify environment variables in the form "NAME=value".
@@ -28,13 +29,36 @@ Example:
 
 type envGet struct {
 	cmd.GuessingCommand
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *envGet) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
+
+// envView is the representation of an environment variable in the json,
+// yaml and template output formats. The value of private variables is
+// never displayed.
+type envView struct {
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+	Public bool   `json:"public" yaml:"public"`
 }
 
 func (c *envGet) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "env-get",
-		Usage:   "env-get [-a/--app appname] [ENVIRONMENT_VARIABLE1] [ENVIRONMENT_VARIABLE2] ...",
-		Desc:    `Retrieves environment variables for an application.`,
+		Name:  "env-get",
+		Usage: "env-get [-a/--app appname] [--format table|json|yaml|template] [--template <template>] [ENVIRONMENT_VARIABLE1] [ENVIRONMENT_VARIABLE2] ...",
+		Desc: `Retrieves environment variables for an application.
+
+The [[--format]] flag prints the variables in the json, yaml or template
+formats, with the fields: name, value and public. The value of private
+variables is always empty.`,
 		MinArgs: 0,
 	}
 }
@@ -50,36 +74,51 @@ func (c *envGet) Run(context *cmd.Context, client *cmd.Client) error {
 		return err
 	}
 	formatted := make([]string, 0, len(variables))
+	views := make([]envView, 0, len(variables))
 	for _, v := range variables {
+		view := envView{Public: v["public"].(bool)}
+		view.Name, _ = v["name"].(string)
 		value := "*** (private variable)"
-		if v["public"].(bool) {
+		if view.Public {
 			value = v["value"].(string)
+			view.Value = value
 		}
 		formatted = append(formatted, fmt.Sprintf("%s=%s", v["name"], value))
+		views = append(views, view)
 	}
 	sort.Strings(formatted)
-	fmt.Fprintln(context.Stdout, strings.Join(formatted, "\n"))
-	return nil
+	sort.Sort(envViewsByName(views))
+	return c.output.render(context.Stdout, views, func() error {
+		fmt.Fprintln(context.Stdout, strings.Join(formatted, "\n"))
+		return nil
+	})
 }
 
+type envViewsByName []envView
+
+func (l envViewsByName) Len() int           { return len(l) }
+func (l envViewsByName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l envViewsByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
 type envSet struct {
 	cmd.GuessingCommand
+	batch appBatch
 }
 
 func (c *envSet) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "env-set",
-		Usage:   "env-set <NAME=value> [NAME=value] ... [-a/--app appname]",
-		Desc:    `Sets environment variables for an application.`,
+		Usage:   "env-set <NAME=value> [NAME=value] ... " + batchUsage,
+		Desc:    "Sets environment variables for an application.\n\n" + fmt.Sprintf(batchDesc, "env-set DEBUG=false"),
 		MinArgs: 1,
 	}
 }
 
+func (c *envSet) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
+}
+
 func (c *envSet) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
 	raw := strings.Join(context.Args, "\n")
 	regex := regexp.MustCompile(`(\w+=[^\n$]+)(\n|$)`)
 	decls := regex.FindAllStringSubmatch(raw, -1)
@@ -91,6 +130,12 @@ func (c *envSet) Run(context *cmd.Context, client *cmd.Client) error {
 		parts := strings.Split(v[1], "=")
 		variables[parts[0]] = strings.Join(parts[1:], "=")
 	}
+	return c.batch.run(context, client, &c.GuessingCommand, func(context *cmd.Context, client *cmd.Client, appName string) error {
+		return setEnv(context, client, appName, variables)
+	})
+}
+
+func setEnv(context *cmd.Context, client *cmd.Client, appName string, variables map[string]string) error {
 	var buf bytes.Buffer
 	json.NewEncoder(&buf).Encode(variables)
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/env", appName))
@@ -120,22 +165,27 @@ func (c *envSet) Run(context *cmd.Context, client *cmd.Client) error {
 
 type envUnset struct {
 	cmd.GuessingCommand
+	batch appBatch
 }
 
 func (c *envUnset) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "env-unset",
-		Usage:   "env-unset <ENVIRONMENT_VARIABLE1> [ENVIRONMENT_VARIABLE2] ... [ENVIRONMENT_VARIABLEN] [-a/--app appname]",
-		Desc:    `Unset environment variables for an application.`,
+		Usage:   "env-unset <ENVIRONMENT_VARIABLE1> [ENVIRONMENT_VARIABLE2] ... [ENVIRONMENT_VARIABLEN] " + batchUsage,
+		Desc:    "Unset environment variables for an application.\n\n" + fmt.Sprintf(batchDesc, "env-unset DEBUG"),
 		MinArgs: 1,
 	}
 }
 
+func (c *envUnset) Flags() *gnuflag.FlagSet {
+	return c.batch.flags()
+}
+
 func (c *envUnset) Run(context *cmd.Context, client *cmd.Client) error {
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
+	return c.batch.run(context, client, &c.GuessingCommand, c.unset)
+}
+
+func (c *envUnset) unset(context *cmd.Context, client *cmd.Client, appName string) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/env", appName))
 	if err != nil {
 		return err
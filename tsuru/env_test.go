@@ -119,7 +119,7 @@ func (s *S) TestEnvGetWithoutTheFlag(c *check.C) {
 	}
 	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	fake := &cmdtest.FakeGuesser{Name: "seek"}
-	err := (&envGet{cmd.GuessingCommand{G: fake}}).Run(&context, client)
+	err := (&envGet{GuessingCommand: cmd.GuessingCommand{G: fake}}).Run(&context, client)
 	c.Assert(err, check.IsNil)
 	c.Assert(stdout.String(), check.Equals, result)
 }
@@ -240,7 +240,7 @@ func (s *S) TestEnvSetWithoutFlag(c *check.C) {
 	}
 	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	fake := &cmdtest.FakeGuesser{Name: "otherapp"}
-	err = (&envSet{cmd.GuessingCommand{G: fake}}).Run(&context, client)
+	err = (&envSet{GuessingCommand: cmd.GuessingCommand{G: fake}}).Run(&context, client)
 	c.Assert(err, check.IsNil)
 	c.Assert(stdout.String(), check.Equals, expectedOut)
 }
@@ -310,7 +310,7 @@ func (s *S) TestEnvUnsetWithoutFlag(c *check.C) {
 	}
 	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	fake := &cmdtest.FakeGuesser{Name: "otherapp"}
-	err = (&envUnset{cmd.GuessingCommand{G: fake}}).Run(&context, client)
+	err = (&envUnset{GuessingCommand: cmd.GuessingCommand{G: fake}}).Run(&context, client)
 	c.Assert(err, check.IsNil)
 	c.Assert(stdout.String(), check.Equals, expectedOut)
 }
@@ -324,3 +324,27 @@ func (s *S) TestRequestEnvURL(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(b, check.DeepEquals, []byte(result))
 }
+
+func (s *S) TestEnvGetFormatYAML(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	jsonResult := `[{"name": "DATABASE_HOST", "value": "somehost", "public": true}, {"name": "DATABASE_PASSWORD", "value": "secret", "public": false}]`
+	result := string(jsonResult)
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: result, Status: http.StatusOK}}, nil, manager)
+	command := envGet{GuessingCommand: cmd.GuessingCommand{G: &cmdtest.FakeGuesser{Name: "someapp"}}}
+	command.Flags().Parse(true, []string{"--format", "yaml"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `- name: DATABASE_HOST
+  value: somehost
+  public: true
+- name: DATABASE_PASSWORD
+  value: ""
+  public: false
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
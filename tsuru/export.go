@@ -0,0 +1,145 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/yaml.v1"
+	"launchpad.net/gnuflag"
+)
+
+// privateEnvPlaceholder is the value app-export writes for private
+// environment variables, which must be replaced before applying the
+// manifest.
+const privateEnvPlaceholder = "(private value, replace it before applying)"
+
+type appExport struct {
+	cmd.GuessingCommand
+	format string
+	fs     *gnuflag.FlagSet
+}
+
+func (c *appExport) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-export",
+		Usage: "app-export [-a/--app appname] [--format yaml|json]",
+		Desc: `Exports an app as a manifest that can be applied with [[tsuru apply]], to
+keep the configuration of the app in version control or to create it again in
+another tsuru server.
+
+The manifest includes the platform, plan, team owner, teams, cnames,
+environment variables, number of units, bound service instances and autoscale
+configuration of the app. Private environment variables are exported with a
+placeholder value that must be replaced before applying the manifest, while
+the variables defined by tsuru (TSURU_*) and by the bound services are left
+out.
+
+The [[--format]] flag chooses between the yaml (default) and json formats.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *appExport) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.format, "format", formatYAML, "Output format: yaml or json")
+	}
+	return c.fs
+}
+
+func (c *appExport) Run(context *cmd.Context, client *cmd.Client) error {
+	if c.format != formatYAML && c.format != formatJSON {
+		return fmt.Errorf("unknown output format %q, use yaml or json", c.format)
+	}
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	manifest, err := exportApp(client, appName)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	if c.format == formatJSON {
+		data, err = json.MarshalIndent(manifest, "", "  ")
+		data = append(data, '\n')
+	} else {
+		data, err = yaml.Marshal(manifest)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = context.Stdout.Write(data)
+	return err
+}
+
+// exportApp builds the manifest that describes the current state of the app.
+func exportApp(client *cmd.Client, appName string) (*appManifest, error) {
+	a, err := getApp(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	units := a.unitCount()
+	manifest := appManifest{
+		Name:      a.Name,
+		Platform:  a.Platform,
+		Plan:      a.Plan.Name,
+		TeamOwner: a.TeamOwner,
+		Teams:     a.Teams,
+		CNames:    a.CName,
+		Units:     &units,
+	}
+	manifest.Env, err = exportEnv(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	services, err := appServiceInstances(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	for _, service := range services {
+		manifest.Services = append(manifest.Services, service.Instances...)
+	}
+	manifest.AutoScale, err = getAutoScale(client, appName)
+	if err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func exportEnv(client *cmd.Client, appName string) (map[string]string, error) {
+	var g cmd.GuessingCommand
+	g.Flags().Parse(true, []string{"-a", appName})
+	b, err := requestEnvURL("GET", g, nil, client)
+	if err != nil {
+		return nil, err
+	}
+	var variables []struct {
+		Name         string
+		Value        string
+		Public       bool
+		InstanceName string
+	}
+	err = json.Unmarshal(b, &variables)
+	if err != nil {
+		return nil, err
+	}
+	env := map[string]string{}
+	for _, v := range variables {
+		if strings.HasPrefix(v.Name, "TSURU_") || v.InstanceName != "" {
+			continue
+		}
+		if v.Public {
+			env[v.Name] = v.Value
+		} else {
+			env[v.Name] = privateEnvPlaceholder
+		}
+	}
+	return env, nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+	"gopkg.in/yaml.v1"
+)
+
+func newExportAPI() *fakeAPI {
+	api := newFakeAPI()
+	api.routes["GET /apps/app1/env"] = []string{`[{"name":"DEBUG","value":"true","public":true},{"name":"SECRET","value":"","public":false},{"name":"TSURU_APPNAME","value":"app1","public":true},{"name":"DATABASE_HOST","value":"db","public":true,"instanceName":"mysql1"}]`}
+	api.routes["GET /autoscale/app1"] = []string{`{"Increase":{"Wait":300000000000,"Expression":"{cpu_max} > 80","Units":2},"Decrease":{"Wait":60000000000,"Expression":"{cpu_max} < 10","Units":1},"MinUnits":2,"MaxUnits":10,"Enabled":true}`}
+	return api
+}
+
+func runAppExport(api *fakeAPI, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: api}, nil, manager)
+	command := appExport{}
+	command.Flags().Parse(true, append([]string{"-a", "app1"}, args...))
+	err := command.Run(&context, client)
+	return stdout.String(), err
+}
+
+func (s *S) TestAppExportInfo(c *check.C) {
+	c.Assert((&appExport{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppExport(c *check.C) {
+	out, err := runAppExport(newExportAPI())
+	c.Assert(err, check.IsNil)
+	var manifest appManifest
+	err = yaml.Unmarshal([]byte(out), &manifest)
+	c.Assert(err, check.IsNil)
+	units := 2
+	c.Assert(manifest, check.DeepEquals, appManifest{
+		Name:      "app1",
+		Platform:  "python",
+		Plan:      "small",
+		TeamOwner: "myteam",
+		Teams:     []string{"myteam", "qa"},
+		CNames:    []string{"old.example.com"},
+		Env:       map[string]string{"DEBUG": "true", "SECRET": privateEnvPlaceholder},
+		Units:     &units,
+		Services:  []string{"mysql1", "redis1"},
+		AutoScale: &manifestAutoScale{
+			Enabled:  true,
+			MinUnits: 2,
+			MaxUnits: 10,
+			Increase: manifestScaleAction{Step: 2, Wait: 300, Expression: "{cpu_max} > 80"},
+			Decrease: manifestScaleAction{Step: 1, Wait: 60, Expression: "{cpu_max} < 10"},
+		},
+	})
+}
+
+func (s *S) TestAppExportJSON(c *check.C) {
+	api := newExportAPI()
+	api.routes["GET /autoscale/app1"] = []string{"404 page not found"}
+	api.routes["GET /services/instances"] = []string{"[]"}
+	out, err := runAppExport(api, "--format", "json")
+	c.Assert(err, check.IsNil)
+	expected := `{
+  "name": "app1",
+  "platform": "python",
+  "plan": "small",
+  "team-owner": "myteam",
+  "teams": [
+    "myteam",
+    "qa"
+  ],
+  "cnames": [
+    "old.example.com"
+  ],
+  "env": {
+    "DEBUG": "true",
+    "SECRET": "(private value, replace it before applying)"
+  },
+  "units": 2
+}
+`
+	c.Assert(out, check.Equals, expected)
+}
+
+func (s *S) TestAppExportInvalidFormat(c *check.C) {
+	_, err := runAppExport(newExportAPI(), "--format", "xml")
+	c.Assert(err, check.ErrorMatches, `unknown output format "xml", use yaml or json`)
+}
+
+func (s *S) TestAppExportCanBeApplied(c *check.C) {
+	api := newExportAPI()
+	out, err := runAppExport(api)
+	c.Assert(err, check.IsNil)
+	out, err = runApply(c, api, out, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, `Plan for app "app1":
+  ! env SECRET has the placeholder of a private value, replace it with the value in the manifest
+  none of the changes can be applied
+`)
+}
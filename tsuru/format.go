@@ -0,0 +1,129 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"text/template"
+
+	"gopkg.in/yaml.v1"
+	"launchpad.net/gnuflag"
+)
+
+const (
+	formatTable    = "table"
+	formatJSON     = "json"
+	formatYAML     = "yaml"
+	formatTemplate = "template"
+)
+
+// outputFormat implements the --format and --template flags shared by the
+// listing commands, which allow them to print their data in machine-readable
+// formats instead of the tables meant for humans.
+//
+// The data given to render must use the view types defined by each command,
+// whose json and yaml tags are the documented field names of the output.
+type outputFormat struct {
+	format   string
+	template string
+}
+
+func (o *outputFormat) addFlags(fs *gnuflag.FlagSet) {
+	fs.StringVar(&o.format, "format", formatTable, "Output format: table, json, yaml or template")
+	fs.StringVar(&o.template, "template", "", "Go template used to render each item, implies --format template")
+}
+
+// isDefault reports whether the default, human-readable, output was chosen.
+func (o *outputFormat) isDefault() bool {
+	return (o.format == "" || o.format == formatTable) && o.template == ""
+}
+
+// usesTemplate reports whether the data should be rendered by the template
+// given in --template. Providing a template without choosing another format
+// selects the template format.
+func (o *outputFormat) usesTemplate() bool {
+	switch o.format {
+	case "", formatTable:
+		return o.template != ""
+	}
+	return o.format == formatTemplate
+}
+
+// render writes data to w in the chosen format. The table function is called
+// to render the default, human-readable, output.
+//
+// In the template format, the template is executed once for each item when
+// data is a slice, and once for the whole data otherwise, each execution
+// followed by a new line. Executions with empty output are skipped, so
+// templates may filter the items.
+func (o *outputFormat) render(w io.Writer, data interface{}, table func() error) error {
+	if o.usesTemplate() {
+		return o.renderTemplate(w, data)
+	}
+	if o.template != "" && (o.format == formatJSON || o.format == formatYAML) {
+		return fmt.Errorf("--template can't be used with --format %s", o.format)
+	}
+	switch o.format {
+	case "", formatTable:
+		return table()
+	case formatJSON:
+		b, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	case formatYAML:
+		b, err := yaml.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}
+	return fmt.Errorf("unknown output format %q, use table, json, yaml or template", o.format)
+}
+
+// renderTemplate executes the template against data, the same way render does
+// in the template format. It's used by commands whose templates run against
+// richer values than the ones printed in the json and yaml formats.
+func (o *outputFormat) renderTemplate(w io.Writer, data interface{}) error {
+	if o.template == "" {
+		return errors.New("please provide the template with --template when using --format template")
+	}
+	tmpl, err := template.New("output").Parse(o.template)
+	if err != nil {
+		return err
+	}
+	items := []interface{}{data}
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Slice {
+		items = make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = v.Index(i).Interface()
+		}
+	}
+	var buf bytes.Buffer
+	for _, item := range items {
+		buf.Reset()
+		err = tmpl.Execute(&buf, item)
+		if err != nil {
+			return err
+		}
+		if buf.Len() == 0 {
+			continue
+		}
+		buf.WriteByte('\n')
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+
+	"gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+type formatItem struct {
+	Name  string `json:"name" yaml:"name"`
+	Units int    `json:"units" yaml:"units"`
+}
+
+func renderFormat(c *check.C, args []string, data interface{}) (string, error) {
+	var output outputFormat
+	fs := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	output.addFlags(fs)
+	err := fs.Parse(true, args)
+	c.Assert(err, check.IsNil)
+	var buf bytes.Buffer
+	err = output.render(&buf, data, func() error {
+		buf.WriteString("table\n")
+		return nil
+	})
+	return buf.String(), err
+}
+
+func (s *S) TestOutputFormatTable(c *check.C) {
+	out, err := renderFormat(c, nil, []formatItem{{Name: "app1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "table\n")
+	out, err = renderFormat(c, []string{"--format", "table"}, []formatItem{{Name: "app1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "table\n")
+}
+
+func (s *S) TestOutputFormatJSON(c *check.C) {
+	out, err := renderFormat(c, []string{"--format", "json"}, []formatItem{{Name: "app1", Units: 2}})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, `[
+  {
+    "name": "app1",
+    "units": 2
+  }
+]
+`)
+}
+
+func (s *S) TestOutputFormatYAML(c *check.C) {
+	out, err := renderFormat(c, []string{"--format", "yaml"}, []formatItem{{Name: "app1", Units: 2}})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "- name: app1\n  units: 2\n")
+}
+
+func (s *S) TestOutputFormatTemplate(c *check.C) {
+	items := []formatItem{{Name: "app1", Units: 2}, {Name: "app2", Units: 1}}
+	out, err := renderFormat(c, []string{"--format", "template", "--template", "{{.Name}}: {{.Units}}"}, items)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "app1: 2\napp2: 1\n")
+	out, err = renderFormat(c, []string{"--format", "template", "--template", "{{.Name}}"}, items[0])
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "app1\n")
+}
+
+func (s *S) TestOutputFormatTemplateSkipsEmptyOutput(c *check.C) {
+	items := []formatItem{{Name: "app1", Units: 2}, {Name: "app2"}, {Name: "app3", Units: 1}}
+	out, err := renderFormat(c, []string{"--template", "{{if .Units}}{{.Name}}{{end}}"}, items)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "app1\napp3\n")
+}
+
+func (s *S) TestOutputFormatTemplateWithoutFormat(c *check.C) {
+	out, err := renderFormat(c, []string{"--template", "{{.Name}}"}, []formatItem{{Name: "app1"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "app1\n")
+}
+
+func (s *S) TestOutputFormatTemplateWithOtherFormat(c *check.C) {
+	_, err := renderFormat(c, []string{"--format", "json", "--template", "{{.Name}}"}, []formatItem{})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "--template can't be used with --format json")
+}
+
+func (s *S) TestOutputFormatTemplateRequiresTemplate(c *check.C) {
+	_, err := renderFormat(c, []string{"--format", "template"}, []formatItem{})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "please provide the template with --template when using --format template")
+}
+
+func (s *S) TestOutputFormatUnknown(c *check.C) {
+	_, err := renderFormat(c, []string{"--format", "xml"}, []formatItem{})
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `unknown output format "xml", use table, json, yaml or template`)
+}
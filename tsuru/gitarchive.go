@@ -0,0 +1,159 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/tsuru/tsuru/exec"
+)
+
+// gitSource is a tree stored in a git repository, used by app-deploy to
+// deploy a ref without a local checkout of it.
+type gitSource struct {
+	// url is the address of the remote repository. When empty, the
+	// repository in the current directory is used.
+	url string
+	// ref is the branch, tag or commit to be deployed, defaulting to HEAD.
+	ref string
+}
+
+// export writes the tree at the ref to dir, returning the id of the commit
+// that was exported. Remote repositories are fetched into a bare repository
+// created inside tmpDir, so only the objects of the given ref are
+// downloaded.
+func (s gitSource) export(tmpDir, dir string) (string, error) {
+	ref := s.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	var repoDir string
+	if s.url != "" {
+		repoDir = filepath.Join(tmpDir, "repo")
+		_, err := runGit("", "init", "--quiet", "--bare", repoDir)
+		if err != nil {
+			return "", err
+		}
+		_, err = runGit(repoDir, "fetch", "--quiet", "--depth", "1", s.url, ref)
+		if err != nil {
+			return "", err
+		}
+		ref = "FETCH_HEAD"
+	}
+	out, err := runGit(repoDir, "rev-parse", "--verify", ref+"^{commit}")
+	if err != nil {
+		return "", err
+	}
+	commit := strings.TrimSpace(string(out))
+	if commit == "" {
+		return "", fmt.Errorf("git: could not resolve %q to a commit", s.ref)
+	}
+	// The archive is extracted as git generates it, so the memory used
+	// doesn't grow with the size of the repository.
+	archive, archiveWriter := io.Pipe()
+	gitErr := make(chan error, 1)
+	go func() {
+		err := streamGit(repoDir, archiveWriter, "archive", "--format=tar", commit)
+		archiveWriter.CloseWithError(err)
+		gitErr <- err
+	}()
+	err = untar(archive, dir)
+	// Unblocks git in case the extraction stopped before the end of the
+	// archive.
+	archive.Close()
+	archiveErr := <-gitErr
+	if err != nil && err != archiveErr {
+		return "", err
+	}
+	if archiveErr != nil {
+		return "", archiveErr
+	}
+	return commit, nil
+}
+
+func runGit(dir string, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	err := streamGit(dir, &stdout, args...)
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+// streamGit runs git, writing its output to stdout. Only the error output is
+// kept in memory, to be used in the error message when git fails.
+func streamGit(dir string, stdout io.Writer, args ...string) error {
+	var stderr bytes.Buffer
+	opts := exec.ExecuteOptions{
+		Cmd:    "git",
+		Args:   args,
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: &stderr,
+	}
+	err := executor().Execute(opts)
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return fmt.Errorf("git %s: %s", args[0], msg)
+	}
+	return nil
+}
+
+// untar extracts the tar stream generated by git archive to dir.
+func untar(r io.Reader, dir string) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := filepath.Clean(filepath.FromSlash(header.Name))
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("invalid path in git archive: %q", header.Name)
+		}
+		path := filepath.Join(dir, name)
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, mode|0700)
+		case tar.TypeSymlink:
+			err = os.Symlink(header.Linkname, path)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeFile(path, reader, mode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, r)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
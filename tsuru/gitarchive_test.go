@@ -0,0 +1,130 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tsuru/tsuru/exec"
+	"github.com/tsuru/tsuru/exec/exectest"
+	"gopkg.in/check.v1"
+)
+
+// gitArchive builds a tar stream like the one generated by git archive.
+func gitArchive(c *check.C, files map[string]string) []byte {
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		header := tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name])), Typeflag: tar.TypeReg}
+		c.Assert(writer.WriteHeader(&header), check.IsNil)
+		_, err := writer.Write([]byte(files[name]))
+		c.Assert(err, check.IsNil)
+	}
+	c.Assert(writer.Close(), check.IsNil)
+	return buf.Bytes()
+}
+
+func (s *S) TestGitSourceExportLocalRef(c *check.C) {
+	commit := "5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a"
+	fexec := exectest.FakeExecutor{
+		Output: map[string][][]byte{
+			"rev-parse --verify HEAD^{commit}": {[]byte(commit + "\n")},
+			"archive --format=tar " + commit:   {gitArchive(c, map[string]string{"app.py": "app"})},
+		},
+	}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	dir := c.MkDir()
+	got, err := gitSource{}.export(dir, filepath.Join(dir, "tree"))
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, commit)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "tree", "app.py"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(content), check.Equals, "app")
+	c.Assert(fexec.GetCommands("git"), check.HasLen, 2)
+}
+
+func (s *S) TestGitSourceExportRemote(c *check.C) {
+	commit := "5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a"
+	fexec := exectest.FakeExecutor{
+		Output: map[string][][]byte{
+			"rev-parse --verify FETCH_HEAD^{commit}": {[]byte(commit + "\n")},
+			"archive --format=tar " + commit:         {gitArchive(c, map[string]string{"app.py": "app"})},
+		},
+	}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	dir := c.MkDir()
+	source := gitSource{url: "https://example.com/app.git", ref: "v1.0"}
+	got, err := source.export(dir, filepath.Join(dir, "tree"))
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.Equals, commit)
+	repoDir := filepath.Join(dir, "repo")
+	c.Assert(fexec.ExecutedCmd("git", []string{"init", "--quiet", "--bare", repoDir}), check.Equals, true)
+	c.Assert(fexec.ExecutedCmd("git", []string{"fetch", "--quiet", "--depth", "1", "https://example.com/app.git", "v1.0"}), check.Equals, true)
+	for _, command := range fexec.GetCommands("git")[1:] {
+		c.Assert(command.GetDir(), check.Equals, repoDir)
+	}
+}
+
+func (s *S) TestGitSourceExportFailure(c *check.C) {
+	execut = &exectest.ErrorExecutor{}
+	defer func() {
+		execut = nil
+	}()
+	dir := c.MkDir()
+	_, err := gitSource{ref: "v1.0"}.export(dir, filepath.Join(dir, "tree"))
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Matches, "git rev-parse: .*")
+}
+
+// failingArchiveExecutor answers git rev-parse with a commit and fails git
+// archive after writing part of the archive.
+type failingArchiveExecutor struct {
+	archive []byte
+}
+
+func (e *failingArchiveExecutor) Execute(opts exec.ExecuteOptions) error {
+	if opts.Args[0] == "rev-parse" {
+		opts.Stdout.Write([]byte("5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a3e5a3a\n"))
+		return nil
+	}
+	opts.Stdout.Write(e.archive[:len(e.archive)/2])
+	opts.Stderr.Write([]byte("fatal: unable to read tree\n"))
+	return errors.New("exit status 128")
+}
+
+func (s *S) TestGitSourceExportArchiveFailure(c *check.C) {
+	execut = &failingArchiveExecutor{archive: gitArchive(c, map[string]string{"app.py": strings.Repeat("app", 1024)})}
+	defer func() {
+		execut = nil
+	}()
+	dir := c.MkDir()
+	_, err := gitSource{}.export(dir, filepath.Join(dir, "tree"))
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, "git archive: fatal: unable to read tree")
+}
+
+func (s *S) TestUntarRejectsPathsOutsideDir(c *check.C) {
+	archive := gitArchive(c, map[string]string{"../evil": "evil"})
+	err := untar(bytes.NewReader(archive), c.MkDir())
+	c.Assert(err, check.NotNil)
+	c.Assert(err.Error(), check.Equals, `invalid path in git archive: "../evil"`)
+}
@@ -0,0 +1,125 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/exec"
+	"gopkg.in/yaml.v1"
+)
+
+// projectFileNames are the names of the project file, looked up in the
+// deploy root in this order.
+var projectFileNames = []string{"tsuru.yaml", "tsuru.yml"}
+
+// deployHooks are the commands app-deploy runs in the local machine, before
+// building the archive and after the deploy finishes. They're read from the
+// pre-deploy and post-deploy lists in the client-hooks section of the project
+// file.
+type deployHooks struct {
+	PreDeploy  []string `yaml:"pre-deploy"`
+	PostDeploy []string `yaml:"post-deploy"`
+}
+
+type projectFile struct {
+	ClientHooks deployHooks `yaml:"client-hooks"`
+}
+
+// readDeployHooks loads the hooks from the project file in the given
+// directory. A missing project file means there are no hooks.
+func readDeployHooks(dir string) (*deployHooks, error) {
+	for _, name := range projectFileNames {
+		f, err := filesystem().Open(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		defer f.Close()
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, err
+		}
+		var project projectFile
+		err = yaml.Unmarshal(data, &project)
+		if err != nil {
+			return nil, fmt.Errorf("invalid project file %s: %s", name, err)
+		}
+		return &project.ClientHooks, nil
+	}
+	return &deployHooks{}, nil
+}
+
+// hookRunner runs the deploy hooks of an app through the executor, in the
+// deploy root.
+type hookRunner struct {
+	context *cmd.Context
+	dir     string
+	appName string
+}
+
+// runPreDeploy runs the pre-deploy hooks, stopping at the first one that
+// fails.
+func (r *hookRunner) runPreDeploy(hooks *deployHooks) error {
+	for _, command := range hooks.PreDeploy {
+		err := r.run("pre-deploy", command, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostDeploy runs the post-deploy hooks, exposing the result of the
+// deploy in the TSURU_DEPLOY_RESULT (success, failure or skipped) and
+// TSURU_DEPLOY_ERROR environment variables.
+func (r *hookRunner) runPostDeploy(hooks *deployHooks, deployErr error) error {
+	result, errMsg := "success", ""
+	if deployErr == errDeploySkipped {
+		result = "skipped"
+	} else if deployErr != nil {
+		result, errMsg = "failure", deployErr.Error()
+	}
+	envs := []string{
+		"TSURU_DEPLOY_RESULT=" + result,
+		"TSURU_DEPLOY_ERROR=" + errMsg,
+	}
+	for _, command := range hooks.PostDeploy {
+		err := r.run("post-deploy", command, envs)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *hookRunner) run(kind, command string, extraEnvs []string) error {
+	target, err := cmd.GetURL("/")
+	if err != nil {
+		return err
+	}
+	envs := append(os.Environ(), "TSURU_APP="+r.appName, "TSURU_TARGET="+target)
+	envs = append(envs, extraEnvs...)
+	fmt.Fprintf(r.context.Stdout, "Running %s hook: %s\n", kind, command)
+	opts := exec.ExecuteOptions{
+		Cmd:    "/bin/sh",
+		Args:   []string{"-c", command},
+		Dir:    r.dir,
+		Envs:   envs,
+		Stdout: r.context.Stdout,
+		Stderr: r.context.Stderr,
+	}
+	err = executor().Execute(opts)
+	if err != nil {
+		return fmt.Errorf("%s hook %q failed: %s", kind, command, err)
+	}
+	return nil
+}
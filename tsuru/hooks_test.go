@@ -0,0 +1,109 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/exec/exectest"
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestReadDeployHooks(c *check.C) {
+	content := `client-hooks:
+  pre-deploy:
+    - make assets
+    - make test
+  post-deploy:
+    - ./notify.sh
+`
+	rfs := &fstest.RecordingFs{FileContent: content}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	hooks, err := readDeployHooks("myapp")
+	c.Assert(err, check.IsNil)
+	c.Assert(rfs.HasAction("open myapp/tsuru.yaml"), check.Equals, true)
+	c.Assert(hooks.PreDeploy, check.DeepEquals, []string{"make assets", "make test"})
+	c.Assert(hooks.PostDeploy, check.DeepEquals, []string{"./notify.sh"})
+}
+
+func (s *S) TestReadDeployHooksWithoutProjectFile(c *check.C) {
+	fsystem = &fstest.FileNotFoundFs{}
+	defer func() {
+		fsystem = nil
+	}()
+	hooks, err := readDeployHooks(".")
+	c.Assert(err, check.IsNil)
+	c.Assert(hooks.PreDeploy, check.HasLen, 0)
+	c.Assert(hooks.PostDeploy, check.HasLen, 0)
+}
+
+func (s *S) TestHookRunnerPreDeploy(c *check.C) {
+	fexec := exectest.FakeExecutor{}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	var stdout bytes.Buffer
+	runner := hookRunner{context: &cmd.Context{Stdout: &stdout}, dir: "myapp", appName: "secret"}
+	err := runner.runPreDeploy(&deployHooks{PreDeploy: []string{"make assets"}})
+	c.Assert(err, check.IsNil)
+	c.Assert(fexec.ExecutedCmd("/bin/sh", []string{"-c", "make assets"}), check.Equals, true)
+	commands := fexec.GetCommands("/bin/sh")
+	c.Assert(commands, check.HasLen, 1)
+	c.Assert(commands[0].GetDir(), check.Equals, "myapp")
+	target, err := cmd.GetURL("/")
+	c.Assert(err, check.IsNil)
+	envs := commands[0].GetEnvs()
+	c.Assert(envs[len(envs)-2:], check.DeepEquals, []string{"TSURU_APP=secret", "TSURU_TARGET=" + target})
+	c.Assert(stdout.String(), check.Equals, "Running pre-deploy hook: make assets\n")
+}
+
+func (s *S) TestHookRunnerPreDeployFailure(c *check.C) {
+	fexec := exectest.ErrorExecutor{}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	var stdout bytes.Buffer
+	runner := hookRunner{context: &cmd.Context{Stdout: &stdout}, appName: "secret"}
+	err := runner.runPreDeploy(&deployHooks{PreDeploy: []string{"make assets", "make test"}})
+	c.Assert(err, check.NotNil)
+	c.Assert(err, check.ErrorMatches, `pre-deploy hook "make assets" failed: .*`)
+	c.Assert(fexec.GetCommands("/bin/sh"), check.HasLen, 1)
+}
+
+func (s *S) TestHookRunnerPostDeploy(c *check.C) {
+	fexec := exectest.FakeExecutor{}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	var stdout bytes.Buffer
+	runner := hookRunner{context: &cmd.Context{Stdout: &stdout}, appName: "secret"}
+	hooks := deployHooks{PostDeploy: []string{"./notify.sh"}}
+	err := runner.runPostDeploy(&hooks, nil)
+	c.Assert(err, check.IsNil)
+	err = runner.runPostDeploy(&hooks, errors.New("deploy failed"))
+	c.Assert(err, check.IsNil)
+	err = runner.runPostDeploy(&hooks, errDeploySkipped)
+	c.Assert(err, check.IsNil)
+	commands := fexec.GetCommands("/bin/sh")
+	c.Assert(commands, check.HasLen, 3)
+	expected := [][]string{
+		{"TSURU_DEPLOY_RESULT=success", "TSURU_DEPLOY_ERROR="},
+		{"TSURU_DEPLOY_RESULT=failure", "TSURU_DEPLOY_ERROR=deploy failed"},
+		{"TSURU_DEPLOY_RESULT=skipped", "TSURU_DEPLOY_ERROR="},
+	}
+	for i, command := range commands {
+		envs := command.GetEnvs()
+		c.Check(envs[len(envs)-2:], check.DeepEquals, expected[i])
+	}
+}
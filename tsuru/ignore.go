@@ -0,0 +1,146 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const ignoreFileName = ".tsuruignore"
+
+type ignorePattern struct {
+	regexp  *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreList is a set of gitignore-style patterns used to exclude files from
+// the archive sent by app-deploy. Patterns are evaluated in order, and the
+// last matching pattern decides whether the path is ignored.
+type ignoreList struct {
+	patterns []ignorePattern
+}
+
+// readIgnoreFile loads the patterns from the given file. A missing file is
+// not an error when optional is true, it just results in an empty list.
+func readIgnoreFile(path string, optional bool) (*ignoreList, error) {
+	f, err := filesystem().Open(path)
+	if err != nil {
+		if optional && os.IsNotExist(err) {
+			return &ignoreList{}, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	return parseIgnoreList(f)
+}
+
+func parseIgnoreList(r io.Reader) (*ignoreList, error) {
+	var list ignoreList
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var pattern ignorePattern
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		anchored := strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		expr := "^" + translatePattern(line) + "$"
+		if !anchored {
+			expr = "^(?:.*/)?" + translatePattern(line) + "$"
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		pattern.regexp = re
+		list.patterns = append(list.patterns, pattern)
+	}
+	return &list, scanner.Err()
+}
+
+// translatePattern converts a gitignore glob into a regular expression.
+func translatePattern(pattern string) string {
+	var expr string
+	for i := 0; i < len(pattern); i++ {
+		ch := pattern[i]
+		switch ch {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				atStart := i == 0 || pattern[i-1] == '/'
+				i++
+				if atStart && i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					expr += "(?:.*/)?"
+				} else {
+					expr += ".*"
+				}
+			} else {
+				expr += "[^/]*"
+			}
+		case '?':
+			expr += "[^/]"
+		case '[':
+			end := strings.Index(pattern[i+1:], "]")
+			if end < 0 {
+				expr += regexp.QuoteMeta(string(ch))
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr += "[" + strings.Replace(class, `\`, `\\`, -1) + "]"
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				ch = pattern[i]
+			}
+			expr += regexp.QuoteMeta(string(ch))
+		default:
+			expr += regexp.QuoteMeta(string(ch))
+		}
+	}
+	return expr
+}
+
+// Match reports whether the given path, relative to the deploy root, should
+// be left out of the archive.
+func (l *ignoreList) Match(path string, isDir bool) bool {
+	if l == nil {
+		return false
+	}
+	path = filepath.ToSlash(filepath.Clean(path))
+	var ignored bool
+	for _, pattern := range l.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.regexp.MatchString(path) {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
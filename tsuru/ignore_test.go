@@ -0,0 +1,89 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+
+	"github.com/tsuru/tsuru/fs/fstest"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestIgnoreListMatch(c *check.C) {
+	patterns := `# comments and blank lines are skipped
+
+*.log
+!important.log
+node_modules/
+/build
+docs/*.md
+**/cache/**
+vendor/**/testdata
+\#notes
+`
+	list, err := parseIgnoreList(strings.NewReader(patterns))
+	c.Assert(err, check.IsNil)
+	var tests = []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"app.log", false, true},
+		{"logs/app.log", false, true},
+		{"important.log", false, false},
+		{"logs/important.log", false, false},
+		{"node_modules", true, true},
+		{"web/node_modules", true, true},
+		{"node_modules", false, false},
+		{"build", true, true},
+		{"src/build", true, false},
+		{"docs/README.md", false, true},
+		{"docs/api/README.md", false, false},
+		{"cache/file", false, true},
+		{"a/b/cache/c/d", false, true},
+		{"vendor/testdata", true, true},
+		{"vendor/a/b/testdata", true, true},
+		{"#notes", false, true},
+		{"main.go", false, false},
+	}
+	for _, t := range tests {
+		c.Check(list.Match(t.path, t.isDir), check.Equals, t.ignored, check.Commentf("path %q", t.path))
+	}
+}
+
+func (s *S) TestIgnoreListMatchLastPatternWins(c *check.C) {
+	list, err := parseIgnoreList(strings.NewReader("!*.txt\n*.txt\n"))
+	c.Assert(err, check.IsNil)
+	c.Assert(list.Match("file.txt", false), check.Equals, true)
+}
+
+func (s *S) TestIgnoreListNilMatchesNothing(c *check.C) {
+	var list *ignoreList
+	c.Assert(list.Match("anything", false), check.Equals, false)
+}
+
+func (s *S) TestReadIgnoreFile(c *check.C) {
+	rfs := &fstest.RecordingFs{FileContent: "*.log\n"}
+	fsystem = rfs
+	defer func() {
+		fsystem = nil
+	}()
+	list, err := readIgnoreFile(".tsuruignore", false)
+	c.Assert(err, check.IsNil)
+	c.Assert(rfs.HasAction("open .tsuruignore"), check.Equals, true)
+	c.Assert(list.Match("app.log", false), check.Equals, true)
+}
+
+func (s *S) TestReadIgnoreFileOptionalNotFound(c *check.C) {
+	fsystem = &fstest.FileNotFoundFs{}
+	defer func() {
+		fsystem = nil
+	}()
+	list, err := readIgnoreFile(".tsuruignore", true)
+	c.Assert(err, check.IsNil)
+	c.Assert(list.Match("app.log", false), check.Equals, false)
+	_, err = readIgnoreFile(".tsuruignore", false)
+	c.Assert(err, check.NotNil)
+}
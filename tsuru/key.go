@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/tsuru/tsuru/cmd"
@@ -127,14 +128,26 @@ func (c *keyRemove) Run(context *cmd.Context, client *cmd.Client) error {
 
 type keyList struct {
 	notrunc bool
+	output  outputFormat
 	fs      *gnuflag.FlagSet
 }
 
+// keyView is the representation of a key in the json, yaml and template
+// output formats.
+type keyView struct {
+	Name    string `json:"name" yaml:"name"`
+	Content string `json:"content" yaml:"content"`
+}
+
 func (c *keyList) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "key-list",
-		Usage: "key-list [-n/--no-truncate]",
-		Desc:  `Lists the public keys registered in the current user account.`,
+		Usage: "key-list [-n/--no-truncate] [--format table|json|yaml|template] [--template <template>]",
+		Desc: `Lists the public keys registered in the current user account.
+
+The [[--format]] flag prints the keys in the json, yaml or template formats,
+with the fields: name and content. The content is never truncated in these
+formats.`,
 	}
 }
 
@@ -157,6 +170,17 @@ func (c *keyList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
+	views := make([]keyView, 0, len(keys))
+	for name, content := range keys {
+		views = append(views, keyView{Name: name, Content: content})
+	}
+	sort.Sort(keyViewsByName(views))
+	return c.output.render(context.Stdout, views, func() error {
+		return c.showTable(keys, context)
+	})
+}
+
+func (c *keyList) showTable(keys map[string]string, context *cmd.Context) error {
 	var table cmd.Table
 	table.Headers = cmd.Row{"Name", "Content"}
 	table.LineSeparator = c.notrunc
@@ -177,6 +201,13 @@ func (c *keyList) Flags() *gnuflag.FlagSet {
 		c.fs = gnuflag.NewFlagSet("key-list", gnuflag.ExitOnError)
 		c.fs.BoolVar(&c.notrunc, "n", false, "disable truncation of key content")
 		c.fs.BoolVar(&c.notrunc, "no-truncate", false, "disable truncation of key content")
+		c.output.addFlags(c.fs)
 	}
 	return c.fs
 }
+
+type keyViewsByName []keyView
+
+func (l keyViewsByName) Len() int           { return len(l) }
+func (l keyViewsByName) Less(i, j int) bool { return l[i].Name < l[j].Name }
+func (l keyViewsByName) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
@@ -218,6 +218,31 @@ func (s *S) TestKeyListNoTruncate(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestKeyListFormatJSON(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	key2Content := strings.Repeat("key2 ", 16)
+	body := fmt.Sprintf(`{"key2":%q,"key1":"key1 content"}`, key2Content)
+	transport := cmdtest.Transport{Message: body, Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	var command keyList
+	command.Flags().Parse(true, []string{"--format", "json"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := fmt.Sprintf(`[
+  {
+    "name": "key1",
+    "content": "key1 content"
+  },
+  {
+    "name": "key2",
+    "content": %q
+  }
+]
+`, key2Content)
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
 func (s *S) TestInfoKeyList(c *check.C) {
 	c.Assert((&keyList{}).Info(), check.NotNil)
 }
@@ -27,7 +27,8 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&appRemove{})
 	m.Register(&unitAdd{})
 	m.Register(&unitRemove{})
-	m.Register(appList{})
+	m.Register(&unitInfo{})
+	m.Register(&appList{})
 	m.Register(&appLog{})
 	m.Register(&appGrant{})
 	m.Register(&appRevoke{})
@@ -42,19 +43,20 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&keyAdd{})
 	m.Register(&keyRemove{})
 	m.Register(&keyList{})
-	m.Register(serviceList{})
+	m.Register(&serviceList{})
 	m.Register(&serviceAdd{})
 	m.Register(&serviceRemove{})
 	m.Register(serviceDoc{})
-	m.Register(serviceInfo{})
+	m.Register(&serviceInfo{})
 	m.Register(serviceInstanceStatus{})
 	m.Register(&serviceBind{})
 	m.Register(&serviceUnbind{})
-	m.Register(platformList{})
+	m.Register(&platformList{})
 	m.Register(&pluginInstall{})
 	m.Register(&pluginRemove{})
 	m.Register(&pluginList{})
 	m.Register(&appSwap{})
+	m.Register(&appRelease{})
 	m.Register(&appDeploy{})
 	m.Register(&planList{})
 	m.Register(&SetTeamOwner{})
@@ -69,12 +71,16 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&teamList{})
 	m.Register(&teamUserAdd{})
 	m.Register(&teamUserRemove{})
-	m.Register(teamUserList{})
+	m.Register(&teamUserList{})
 	m.Register(&changePassword{})
 	m.Register(&showAPIToken{})
 	m.Register(&regenerateAPIToken{})
 	m.Register(&appDeployList{})
+	m.Register(&appDeployInfo{})
 	m.Register(&appDeployRollback{})
+	m.Register(&apply{})
+	m.Register(&appExport{})
+	m.Register(&appClone{})
 	m.Register(&cmd.ShellToContainerCmd{})
 	return m
 }
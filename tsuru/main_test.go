@@ -40,7 +40,7 @@ func (s *S) TestAppListIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	list, ok := manager.Commands["app-list"]
 	c.Assert(ok, check.Equals, true)
-	c.Assert(list, check.FitsTypeOf, appList{})
+	c.Assert(list, check.FitsTypeOf, &appList{})
 }
 
 func (s *S) TestAppGrantIsRegistered(c *check.C) {
@@ -124,7 +124,7 @@ func (s *S) TestServiceListIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	list, ok := manager.Commands["service-list"]
 	c.Assert(ok, check.Equals, true)
-	c.Assert(list, check.FitsTypeOf, serviceList{})
+	c.Assert(list, check.FitsTypeOf, &serviceList{})
 }
 
 func (s *S) TestServiceAddIsRegistered(c *check.C) {
@@ -166,7 +166,7 @@ func (s *S) TestServiceInfoIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	info, ok := manager.Commands["service-info"]
 	c.Assert(ok, check.Equals, true)
-	c.Assert(info, check.FitsTypeOf, serviceInfo{})
+	c.Assert(info, check.FitsTypeOf, &serviceInfo{})
 }
 
 func (s *S) TestServiceInstanceStatusIsRegistered(c *check.C) {
@@ -197,6 +197,13 @@ func (s *S) TestUnitRemoveIsRegistered(c *check.C) {
 	c.Assert(rmunit, check.FitsTypeOf, &unitRemove{})
 }
 
+func (s *S) TestUnitInfoIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	unitinfo, ok := manager.Commands["unit-info"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(unitinfo, check.FitsTypeOf, &unitInfo{})
+}
+
 func (s *S) TestCNameAddIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	cname, ok := manager.Commands["cname-add"]
@@ -215,7 +222,7 @@ func (s *S) TestPlatformListIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	plat, ok := manager.Commands["platform-list"]
 	c.Assert(ok, check.Equals, true)
-	c.Assert(plat, check.FitsTypeOf, platformList{})
+	c.Assert(plat, check.FitsTypeOf, &platformList{})
 }
 
 func (s *S) TestAppSwapIsRegistered(c *check.C) {
@@ -225,6 +232,13 @@ func (s *S) TestAppSwapIsRegistered(c *check.C) {
 	c.Assert(cmd, check.FitsTypeOf, &appSwap{})
 }
 
+func (s *S) TestAppReleaseIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	release, ok := manager.Commands["app-release"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(release, check.FitsTypeOf, &appRelease{})
+}
+
 func (s *S) TestAppStartIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	start, ok := manager.Commands["app-start"]
@@ -279,6 +293,34 @@ func (s *S) TestAppDeployIsRegistered(c *check.C) {
 	c.Assert(deployCmd, check.FitsTypeOf, &appDeploy{})
 }
 
+func (s *S) TestAppDeployInfoIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	info, ok := manager.Commands["app-deploy-info"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(info, check.FitsTypeOf, &appDeployInfo{})
+}
+
+func (s *S) TestApplyIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	applyCmd, ok := manager.Commands["apply"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(applyCmd, check.FitsTypeOf, &apply{})
+}
+
+func (s *S) TestAppExportIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	export, ok := manager.Commands["app-export"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(export, check.FitsTypeOf, &appExport{})
+}
+
+func (s *S) TestAppCloneIsRegistered(c *check.C) {
+	manager := buildManager("tsuru")
+	clone, ok := manager.Commands["app-clone"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(clone, check.FitsTypeOf, &appClone{})
+}
+
 func (s *S) TestPlanListRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	list, ok := manager.Commands["plan-list"]
@@ -353,7 +395,7 @@ func (s *S) TestTeamUserListIsRegistered(c *check.C) {
 	manager := buildManager("tsuru")
 	listuser, ok := manager.Commands["team-user-list"]
 	c.Assert(ok, check.Equals, true)
-	c.Assert(listuser, check.FitsTypeOf, teamUserList{})
+	c.Assert(listuser, check.FitsTypeOf, &teamUserList{})
 }
 
 func (s *S) TestUserCreateIsRegistered(c *check.C) {
@@ -16,8 +16,9 @@ import (
 )
 
 type planList struct {
-	human bool
-	fs    *gnuflag.FlagSet
+	human  bool
+	output outputFormat
+	fs     *gnuflag.FlagSet
 }
 
 func (c *planList) Flags() *gnuflag.FlagSet {
@@ -26,19 +27,46 @@ func (c *planList) Flags() *gnuflag.FlagSet {
 		human := "Humanized units for memory and swap."
 		c.fs.BoolVar(&c.human, "human", false, human)
 		c.fs.BoolVar(&c.human, "h", false, human)
+		c.output.addFlags(c.fs)
 	}
 	return c.fs
 }
 
 func (c *planList) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "plan-list",
-		Usage:   "plan-list [--human]",
-		Desc:    "List available plans that can be used when creating an app.",
+		Name:  "plan-list",
+		Usage: "plan-list [--human] [--format table|json|yaml|template] [--template <template>]",
+		Desc: `List available plans that can be used when creating an app.
+
+The [[--format]] flag prints the plans in the json, yaml or template formats,
+with the fields: name, memory, swap, cpushare, router and default. Memory and
+swap are always in bytes.`,
 		MinArgs: 0,
 	}
 }
 
+// planView is the representation of a plan in the json, yaml and template
+// output formats.
+type planView struct {
+	Name     string `json:"name" yaml:"name"`
+	Memory   int64  `json:"memory" yaml:"memory"`
+	Swap     int64  `json:"swap" yaml:"swap"`
+	CpuShare int    `json:"cpushare" yaml:"cpushare"`
+	Router   string `json:"router" yaml:"router"`
+	Default  bool   `json:"default" yaml:"default"`
+}
+
+func newPlanView(p tsuruapp.Plan) planView {
+	return planView{
+		Name:     p.Name,
+		Memory:   p.Memory,
+		Swap:     p.Swap,
+		CpuShare: p.CpuShare,
+		Router:   p.Router,
+		Default:  p.Default,
+	}
+}
+
 func renderPlans(plans []tsuruapp.Plan, isHuman bool) string {
 	table := cmd.NewTable()
 	table.Headers = []string{"Name", "Memory", "Swap", "Cpu Share", "Router", "Default"}
@@ -80,10 +108,16 @@ func (c *planList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	if len(plans) == 0 {
-		fmt.Fprintln(context.Stdout, "No plans available.")
-		return nil
+	views := make([]planView, len(plans))
+	for i, p := range plans {
+		views[i] = newPlanView(p)
 	}
-	fmt.Fprintf(context.Stdout, "%s", renderPlans(plans, c.human))
-	return nil
+	return c.output.render(context.Stdout, views, func() error {
+		if len(plans) == 0 {
+			fmt.Fprintln(context.Stdout, "No plans available.")
+			return nil
+		}
+		fmt.Fprintf(context.Stdout, "%s", renderPlans(plans, c.human))
+		return nil
+	})
 }
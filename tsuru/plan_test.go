@@ -48,6 +48,26 @@ func (s *S) TestPlanList(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestPlanListFormatYAML(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"name": "test", "memory": 536870912, "swap": 268435456, "cpushare": 100, "router": "r1", "default": true}]`
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	trans := &cmdtest.Transport{Message: result, Status: http.StatusOK}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := planList{}
+	command.Flags().Parse(true, []string{"--human", "--format", "yaml"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `- name: test
+  memory: 536870912
+  swap: 268435456
+  cpushare: 100
+  router: r1
+  default: true
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
 func (s *S) TestPlanListHuman(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	result := `[
@@ -11,15 +11,27 @@ import (
 	"sort"
 
 	"github.com/tsuru/tsuru/cmd"
+	"launchpad.net/gnuflag"
 )
 
 type platform struct {
-	Name string
+	Name string `json:"name" yaml:"name"`
 }
 
-type platformList struct{}
+type platformList struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *platformList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("platform-list", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
 
-func (platformList) Run(context *cmd.Context, client *cmd.Client) error {
+func (c platformList) Run(context *cmd.Context, client *cmd.Client) error {
 	url, err := cmd.GetURL("/platforms")
 	if err != nil {
 		return err
@@ -38,26 +50,35 @@ func (platformList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	if len(platforms) == 0 {
-		fmt.Fprintln(context.Stdout, "No platforms available.")
-		return nil
-	}
 	platformNames := make([]string, len(platforms))
 	for i, p := range platforms {
 		platformNames[i] = p.Name
 	}
 	sort.Strings(platformNames)
-	for _, p := range platformNames {
-		fmt.Fprintf(context.Stdout, "- %s\n", p)
+	views := make([]platform, len(platformNames))
+	for i, name := range platformNames {
+		views[i] = platform{Name: name}
 	}
-	return nil
+	return c.output.render(context.Stdout, views, func() error {
+		if len(platforms) == 0 {
+			fmt.Fprintln(context.Stdout, "No platforms available.")
+			return nil
+		}
+		for _, p := range platformNames {
+			fmt.Fprintf(context.Stdout, "- %s\n", p)
+		}
+		return nil
+	})
 }
 
 func (platformList) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "platform-list",
-		Usage:   "platform-list",
-		Desc:    "Lists the available platforms. All platforms displayed in this list may be used to create new apps (see app-create).",
+		Name:  "platform-list",
+		Usage: "platform-list [--format table|json|yaml|template] [--template <template>]",
+		Desc: `Lists the available platforms. All platforms displayed in this list may be used to create new apps (see app-create).
+
+The [[--format]] flag prints the platforms in the json, yaml or template
+formats, with the field: name.`,
 		MinArgs: 0,
 	}
 }
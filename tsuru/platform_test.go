@@ -36,6 +36,21 @@ func (s *S) TestPlatformList(c *check.C) {
 	c.Assert(buf.String(), check.Equals, expected)
 }
 
+func (s *S) TestPlatformListFormatTemplate(c *check.C) {
+	var buf bytes.Buffer
+	transport := cmdtest.Transport{
+		Status:  http.StatusOK,
+		Message: `[{"Name":"ruby"},{"Name":"python"}]`,
+	}
+	context := cmd.Context{Stdout: &buf}
+	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	command := platformList{}
+	command.Flags().Parse(true, []string{"--template", "platform: {{.Name}}"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(buf.String(), check.Equals, "platform: python\nplatform: ruby\n")
+}
+
 func (s *S) TestPlatformListEmpty(c *check.C) {
 	var buf bytes.Buffer
 	transport := cmdtest.Transport{
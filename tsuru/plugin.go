@@ -13,6 +13,7 @@ import (
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/exec"
+	"launchpad.net/gnuflag"
 )
 
 type pluginInstall struct{}
@@ -121,13 +122,33 @@ func (c *pluginRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
-type pluginList struct{}
+type pluginList struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *pluginList) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("plugin-list", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
+
+// pluginView is the representation of a plugin in the json, yaml and
+// template output formats.
+type pluginView struct {
+	Name string `json:"name" yaml:"name"`
+}
 
 func (pluginList) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "plugin-list",
-		Usage:   "plugin-list",
-		Desc:    "List installed tsuru plugins.",
+		Name:  "plugin-list",
+		Usage: "plugin-list [--format table|json|yaml|template] [--template <template>]",
+		Desc: `List installed tsuru plugins.
+
+The [[--format]] flag prints the plugins in the json, yaml or template
+formats, with the field: name.`,
 		MinArgs: 0,
 	}
 }
@@ -135,8 +156,14 @@ func (pluginList) Info() *cmd.Info {
 func (c *pluginList) Run(context *cmd.Context, client *cmd.Client) error {
 	pluginsPath := cmd.JoinWithUserDir(".tsuru", "plugins")
 	plugins, _ := ioutil.ReadDir(pluginsPath)
-	for _, p := range plugins {
-		fmt.Println(p.Name())
-	}
-	return nil
+	views := make([]pluginView, len(plugins))
+	for i, p := range plugins {
+		views[i] = pluginView{Name: p.Name()}
+	}
+	return c.output.render(context.Stdout, views, func() error {
+		for _, p := range plugins {
+			fmt.Fprintln(context.Stdout, p.Name())
+		}
+		return nil
+	})
 }
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/exec/exectest"
@@ -154,6 +155,34 @@ func (s *S) TestPluginRemoveIsACommand(c *check.C) {
 	var _ cmd.Command = &pluginRemove{}
 }
 
+func (s *S) TestPluginListFormatJSON(c *check.C) {
+	home := c.MkDir()
+	pluginsPath := filepath.Join(home, ".tsuru", "plugins")
+	c.Assert(os.MkdirAll(pluginsPath, 0755), check.IsNil)
+	for _, name := range []string{"myplugin", "otherplugin"} {
+		c.Assert(ioutil.WriteFile(filepath.Join(pluginsPath, name), []byte("#!/bin/sh\n"), 0755), check.IsNil)
+	}
+	oldHome := os.Getenv("HOME")
+	os.Setenv("HOME", home)
+	defer os.Setenv("HOME", oldHome)
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout}
+	command := pluginList{}
+	command.Flags().Parse(true, []string{"--format", "json"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	expected := `[
+  {
+    "name": "myplugin"
+  },
+  {
+    "name": "otherplugin"
+  }
+]
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
 func (s *S) TestPluginListInfo(c *check.C) {
 	c.Assert(pluginList{}.Info(), check.NotNil)
 }
@@ -0,0 +1,173 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ttyProgressInterval   = 500 * time.Millisecond
+	plainProgressInterval = 10 * time.Second
+)
+
+// progressReporter renders the progress of an upload. The percentage and the
+// ETA are based on how much of the files being deployed was already
+// archived, while the bytes sent and the rate are based on the compressed
+// data written to the request body.
+//
+// On a terminal the progress line is redrawn in place, otherwise a plain line
+// is printed periodically.
+type progressReporter struct {
+	// archived and sent are updated atomically and must stay at the top of
+	// the struct to be 64-bit aligned.
+	archived int64
+	sent     int64
+	total    int64
+	out      io.Writer
+	tty      bool
+	interval time.Duration
+	start    time.Time
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func newProgressReporter(out io.Writer, total int64) *progressReporter {
+	p := progressReporter{out: out, total: total, interval: plainProgressInterval}
+	if isTerminal(out) {
+		p.tty = true
+		p.interval = ttyProgressInterval
+	}
+	return &p
+}
+
+func (p *progressReporter) Start() {
+	p.start = time.Now()
+	p.done = make(chan struct{})
+	p.wg.Add(1)
+	go p.loop()
+}
+
+func (p *progressReporter) loop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	if p.tty {
+		p.print()
+	} else {
+		fmt.Fprintln(p.out, "Uploading files...")
+	}
+	for {
+		select {
+		case <-ticker.C:
+			p.print()
+		case <-p.done:
+			return
+		}
+	}
+}
+
+// Stop finishes the reporting, printing a summary of the upload when it
+// succeeded, that is, when err is nil. It's safe to write to the output after
+// Stop returns.
+func (p *progressReporter) Stop(err error) {
+	if p.done == nil {
+		return
+	}
+	close(p.done)
+	p.wg.Wait()
+	p.done = nil
+	if err != nil {
+		if p.tty {
+			fmt.Fprint(p.out, "\r\x1b[K")
+		}
+		return
+	}
+	elapsed := time.Since(p.start)
+	sent := atomic.LoadInt64(&p.sent)
+	summary := fmt.Sprintf("Uploaded %s in %s (%s/s)", formatSize(sent), formatDuration(elapsed), formatSize(rate(sent, elapsed)))
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s\x1b[K\n", summary)
+	} else {
+		fmt.Fprintln(p.out, summary)
+	}
+}
+
+func (p *progressReporter) print() {
+	line := p.render(time.Since(p.start))
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s\x1b[K", line)
+	} else {
+		fmt.Fprintln(p.out, line)
+	}
+}
+
+func (p *progressReporter) render(elapsed time.Duration) string {
+	archived := atomic.LoadInt64(&p.archived)
+	sent := atomic.LoadInt64(&p.sent)
+	parts := []string{"Uploading files..."}
+	if p.total > 0 {
+		if archived > p.total {
+			archived = p.total
+		}
+		parts = append(parts, fmt.Sprintf("%5.1f%%", float64(archived)*100/float64(p.total)))
+	}
+	parts = append(parts, fmt.Sprintf("%s sent", formatSize(sent)))
+	parts = append(parts, fmt.Sprintf("%s/s", formatSize(rate(sent, elapsed))))
+	if p.total > 0 && archived > 0 {
+		remaining := time.Duration(float64(elapsed) * float64(p.total-archived) / float64(archived))
+		parts = append(parts, "ETA "+formatDuration(remaining))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Writer wraps w, counting the bytes written to it as sent.
+func (p *progressReporter) Writer(w io.Writer) io.Writer {
+	return &progressWriter{Writer: w, n: &p.sent}
+}
+
+// Reader wraps r, counting the bytes read from it as archived.
+func (p *progressReporter) Reader(r io.Reader) io.Reader {
+	return &progressReader{Reader: r, n: &p.archived}
+}
+
+type progressWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	n, err := w.Writer.Write(b)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+type progressReader struct {
+	io.Reader
+	n *int64
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	atomic.AddInt64(r.n, int64(n))
+	return n, err
+}
+
+func rate(n int64, elapsed time.Duration) int64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(n) / elapsed.Seconds())
+}
+
+func formatDuration(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestProgressReporterRender(c *check.C) {
+	p := newProgressReporter(ioutil.Discard, 4096)
+	p.archived = 1024
+	p.sent = 2048
+	c.Assert(p.render(2*time.Second), check.Equals, "Uploading files...  25.0% 2.0 KB sent 1.0 KB/s ETA 00:06")
+}
+
+func (s *S) TestProgressReporterRenderUnknownTotal(c *check.C) {
+	p := newProgressReporter(ioutil.Discard, 0)
+	p.sent = 100
+	c.Assert(p.render(time.Second), check.Equals, "Uploading files... 100 B sent 100 B/s")
+}
+
+func (s *S) TestProgressReporterCounters(c *check.C) {
+	p := newProgressReporter(ioutil.Discard, 10)
+	var buf bytes.Buffer
+	w := p.Writer(&buf)
+	w.Write([]byte("hello"))
+	r := p.Reader(strings.NewReader("some content"))
+	ioutil.ReadAll(r)
+	c.Assert(p.sent, check.Equals, int64(5))
+	c.Assert(p.archived, check.Equals, int64(12))
+	c.Assert(buf.String(), check.Equals, "hello")
+}
+
+func (s *S) TestProgressReporterPlainOutput(c *check.C) {
+	var out bytes.Buffer
+	p := newProgressReporter(&out, 10)
+	c.Assert(p.tty, check.Equals, false)
+	p.interval = 10 * time.Millisecond
+	p.Start()
+	p.Writer(ioutil.Discard).Write([]byte("data"))
+	time.Sleep(50 * time.Millisecond)
+	p.Stop(nil)
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	c.Assert(len(lines) > 2, check.Equals, true)
+	c.Assert(lines[0], check.Equals, "Uploading files...")
+	c.Assert(lines[1], check.Matches, `Uploading files\.\.\. +0\.0% \d+ B sent .*`)
+	c.Assert(lines[len(lines)-1], check.Matches, `Uploaded 4 B in 00:00 \(.+/s\)`)
+}
+
+func (s *S) TestProgressReporterStopWithoutStart(c *check.C) {
+	var out bytes.Buffer
+	p := newProgressReporter(&out, 10)
+	p.Stop(nil)
+	c.Assert(out.String(), check.Equals, "")
+}
+
+func (s *S) TestProgressReporterStopAfterFailure(c *check.C) {
+	var out bytes.Buffer
+	p := newProgressReporter(&out, 10)
+	p.Start()
+	p.Writer(ioutil.Discard).Write([]byte("data"))
+	p.Stop(errors.New("connection reset by peer"))
+	c.Assert(out.String(), check.Equals, "Uploading files...\n")
+}
@@ -0,0 +1,231 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"github.com/tsuru/tsuru/exec"
+	"launchpad.net/gnuflag"
+)
+
+const defaultReleaseGrace = time.Minute
+
+// releaseCheckInterval is the interval between the checks made by
+// app-release after the swap.
+var releaseCheckInterval = 10 * time.Second
+
+// smokeHTTPClient is the client used in the HTTP checks of app-release.
+var smokeHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+type appRelease struct {
+	blue         string
+	green        string
+	idle         string
+	source       string
+	smokeCommand string
+	smokePath    string
+	timeout      time.Duration
+	grace        time.Duration
+	force        bool
+	fs           *gnuflag.FlagSet
+}
+
+func (c *appRelease) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-release",
+		Usage: "app-release --blue <app1-name> --green <app2-name> --source <dir> [--idle <appname>] [--smoke-command <command>] [--smoke-path <path>] [--timeout <duration>] [--grace <duration>] [-f/--force]",
+		Desc: `Releases a new version of an app with a blue/green deploy between two apps,
+swapping the routing between them (see [[tsuru app-swap]]).
+
+The files in the [[--source]] directory are deployed to the idle app, and the
+command waits until all its units are started. The live app is the one with
+cnames, as the cnames move along with the routing in swaps; use [[--idle]]
+when neither or both apps have cnames.
+
+Before the swap, the idle app may be checked with a command, given in
+[[--smoke-command]] and run with TSURU_APP and TSURU_APP_ADDRESS in the
+environment, and with an HTTP request to the path given in [[--smoke-path]],
+which must answer with a status lower than 400. The swap is only made when the
+checks pass.
+
+After the swap, the same checks are repeated against the address of the live
+app during the grace window given in [[--grace]] (1 minute by default). If
+any of them fails, the apps are swapped back. For example::
+
+    $ tsuru app-release --blue myapp-blue --green myapp-green --source . --smoke-path /healthcheck`,
+		MinArgs: 0,
+	}
+}
+
+func (c *appRelease) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-release", gnuflag.ExitOnError)
+		c.fs.StringVar(&c.blue, "blue", "", "One of the apps of the release")
+		c.fs.StringVar(&c.green, "green", "", "The other app of the release")
+		c.fs.StringVar(&c.idle, "idle", "", "The app that doesn't receive traffic, when it can't be told by the cnames")
+		c.fs.StringVar(&c.source, "source", "", "Directory deployed to the idle app")
+		c.fs.StringVar(&c.smokeCommand, "smoke-command", "", "Command that checks the app, run before and after the swap")
+		c.fs.StringVar(&c.smokePath, "smoke-path", "", "Path requested to check the app, before and after the swap")
+		c.fs.DurationVar(&c.timeout, "timeout", defaultDeployWaitTimeout, "How long to wait for the units of the idle app to start")
+		c.fs.DurationVar(&c.grace, "grace", defaultReleaseGrace, "How long the checks are repeated after the swap")
+		c.fs.BoolVar(&c.force, "force", false, "Swap apps with different number of units or different platform")
+		c.fs.BoolVar(&c.force, "f", false, "Swap apps with different number of units or different platform")
+	}
+	return c.fs
+}
+
+func (c *appRelease) Run(context *cmd.Context, client *cmd.Client) error {
+	if c.blue == "" || c.green == "" || c.source == "" {
+		return errors.New("please provide the apps in --blue and --green, and the directory to deploy in --source")
+	}
+	if c.blue == c.green {
+		return errors.New("the blue and green apps must be different")
+	}
+	blue, err := getApp(client, c.blue)
+	if err != nil {
+		return err
+	}
+	green, err := getApp(client, c.green)
+	if err != nil {
+		return err
+	}
+	live, idle, err := c.releaseApps(blue, green)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Releasing to idle app %q, live app is %q\n", idle.Name, live.Name)
+	deploy := appCommandChange(&appDeploy{}, idle.Name, []string{c.source}, "--wait", "--timeout", c.timeout.String())
+	err = deploy(context, client)
+	if err == cmd.ErrAbortCommand {
+		err = errors.New("the deploy failed")
+	}
+	if err != nil {
+		return fmt.Errorf("could not deploy to app %q: %s", idle.Name, err)
+	}
+	if c.hasChecks() {
+		fmt.Fprintf(context.Stdout, "Checking app %q...\n", idle.Name)
+		err = c.check(context, idle.Name, idle.Ip)
+		if err != nil {
+			return fmt.Errorf("app %q failed the checks, the apps were not swapped: %s", idle.Name, err)
+		}
+	}
+	fmt.Fprintf(context.Stdout, "Swapping apps %q and %q...\n", live.Name, idle.Name)
+	err = swapApps(client, live.Name, idle.Name, c.force)
+	if err != nil {
+		if e, ok := err.(*tsuruErrors.HTTP); ok && e.Code == http.StatusPreconditionFailed {
+			return fmt.Errorf("could not swap the apps: %s, use --force to swap anyway", strings.TrimRight(e.Message, "\n"))
+		}
+		return fmt.Errorf("could not swap the apps: %s", err)
+	}
+	if c.hasChecks() && c.grace > 0 {
+		fmt.Fprintf(context.Stdout, "Checking app %q for %s...\n", live.Name, c.grace)
+		err = c.checkDuring(context, live.Name, live.Ip, c.grace)
+		if err != nil {
+			fmt.Fprintf(context.Stdout, "Check failed, swapping apps %q and %q back...\n", live.Name, idle.Name)
+			swapErr := swapApps(client, live.Name, idle.Name, true)
+			if swapErr != nil {
+				return fmt.Errorf("app %q failed the checks after the swap: %s (swap back failed: %s)", live.Name, err, swapErr)
+			}
+			return fmt.Errorf("app %q failed the checks after the swap, the apps were swapped back: %s", live.Name, err)
+		}
+	}
+	fmt.Fprintf(context.Stdout, "App %q successfully released!\n", idle.Name)
+	return nil
+}
+
+// releaseApps tells which of the apps is live and which is idle.
+func (c *appRelease) releaseApps(blue, green *app) (live, idle *app, err error) {
+	switch {
+	case c.idle == blue.Name:
+		return green, blue, nil
+	case c.idle == green.Name:
+		return blue, green, nil
+	case c.idle != "":
+		return nil, nil, fmt.Errorf("the idle app must be either %q or %q", blue.Name, green.Name)
+	case len(blue.CName) > 0 && len(green.CName) == 0:
+		return blue, green, nil
+	case len(green.CName) > 0 && len(blue.CName) == 0:
+		return green, blue, nil
+	}
+	return nil, nil, fmt.Errorf("could not tell which app is idle, as neither or both %q and %q have cnames, please use --idle", blue.Name, green.Name)
+}
+
+func (c *appRelease) hasChecks() bool {
+	return c.smokeCommand != "" || c.smokePath != ""
+}
+
+// check runs the checks given in --smoke-path and --smoke-command against
+// the app.
+func (c *appRelease) check(context *cmd.Context, appName, address string) error {
+	if c.smokePath != "" {
+		url := "http://" + address + c.smokePath
+		resp, err := smokeHTTPClient.Get(url)
+		if err != nil {
+			return fmt.Errorf("request to %s failed: %s", url, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return fmt.Errorf("request to %s failed with status %d", url, resp.StatusCode)
+		}
+	}
+	if c.smokeCommand != "" {
+		target, err := cmd.GetURL("/")
+		if err != nil {
+			return err
+		}
+		opts := exec.ExecuteOptions{
+			Cmd:  "/bin/sh",
+			Args: []string{"-c", c.smokeCommand},
+			Envs: append(os.Environ(),
+				"TSURU_APP="+appName,
+				"TSURU_APP_ADDRESS="+address,
+				"TSURU_TARGET="+target,
+			),
+			Stdout: context.Stdout,
+			Stderr: context.Stderr,
+		}
+		err = executor().Execute(opts)
+		if err != nil {
+			return fmt.Errorf("smoke command %q failed: %s", c.smokeCommand, err)
+		}
+	}
+	return nil
+}
+
+// checkDuring repeats the checks until the given duration passes or one of
+// them fails.
+func (c *appRelease) checkDuring(context *cmd.Context, appName, address string, d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		err := c.check(context, appName, address)
+		if err != nil {
+			return err
+		}
+		remaining := deadline.Sub(time.Now())
+		if remaining <= 0 {
+			return nil
+		}
+		if remaining > releaseCheckInterval {
+			remaining = releaseCheckInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+func swapApps(client *cmd.Client, app1, app2 string, force bool) error {
+	url, err := cmd.GetURL(fmt.Sprintf("/swap?app1=%s&app2=%s&force=%t", app1, app2, force))
+	if err != nil {
+		return err
+	}
+	return makeSwap(client, url)
+}
@@ -0,0 +1,187 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/exec/exectest"
+	"gopkg.in/check.v1"
+)
+
+// releaseAPI serves the apps of the release tests, recording the requests
+// that aren't GETs, with their query strings. The routes in statuses are
+// answered with the given status instead of 200.
+type releaseAPI struct {
+	api      *fakeAPI
+	statuses map[string]int
+	requests []string
+}
+
+func (r *releaseAPI) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != "GET" {
+		r.requests = append(r.requests, req.Method+" "+req.URL.RequestURI())
+	}
+	resp, err := r.api.RoundTrip(req)
+	if status, ok := r.statuses[req.Method+" "+req.URL.Path]; ok && err == nil {
+		resp.StatusCode = status
+	}
+	return resp, err
+}
+
+func newReleaseAPI() *releaseAPI {
+	return &releaseAPI{api: &fakeAPI{routes: map[string][]string{
+		"GET /apps/app1":         {`{"name":"app1","ip":"app1.tsuru.io","cname":["www.example.com"],"units":[{"Name":"app1/0","Status":"started"}]}`},
+		"GET /apps/app2":         {`{"name":"app2","ip":"app2.tsuru.io","units":[{"Name":"app2/0","Status":"started"}]}`},
+		"POST /apps/app2/deploy": {"deploying\nOK\n"},
+	}}}
+}
+
+// smokeServer replaces the client of the HTTP checks with one that answers
+// with the given status for each host, recording the requested URLs.
+func smokeServer(statuses map[string]int) (*[]string, func()) {
+	old := smokeHTTPClient
+	var requested []string
+	smokeHTTPClient = &http.Client{Transport: transportFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		return &http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			StatusCode: statuses[req.URL.Host],
+		}, nil
+	})}
+	return &requested, func() { smokeHTTPClient = old }
+}
+
+func runAppRelease(api http.RoundTripper, args ...string) (string, error) {
+	oldInterval := releaseCheckInterval
+	releaseCheckInterval = 10 * time.Millisecond
+	defer func() {
+		releaseCheckInterval = oldInterval
+	}()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: api}, nil, manager)
+	command := appRelease{}
+	command.Flags().Parse(true, args)
+	err := command.Run(&context, client)
+	return stdout.String(), err
+}
+
+func (s *S) TestAppReleaseInfo(c *check.C) {
+	c.Assert((&appRelease{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppRelease(c *check.C) {
+	fexec := exectest.FakeExecutor{}
+	execut = &fexec
+	defer func() {
+		execut = nil
+	}()
+	requested, restore := smokeServer(map[string]int{"app1.tsuru.io": 200, "app2.tsuru.io": 200})
+	defer restore()
+	api := newReleaseAPI()
+	out, err := runAppRelease(api, "--blue", "app1", "--green", "app2", "--source", "testdata",
+		"--smoke-path", "/health", "--smoke-command", "make smoke", "--grace", "30ms")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `(?s)Releasing to idle app "app2", live app is "app1"
+.*deploying
+OK
+Waiting for units to start...
+All units started.
+Checking app "app2"...
+Swapping apps "app1" and "app2"...
+Checking app "app1" for 30ms...
+App "app2" successfully released!
+`)
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"POST /apps/app2/deploy",
+		"PUT /swap?app1=app1&app2=app2&force=false",
+	})
+	c.Assert((*requested)[0], check.Equals, "http://app2.tsuru.io/health")
+	c.Assert(len(*requested) > 2, check.Equals, true)
+	for _, url := range (*requested)[1:] {
+		c.Assert(url, check.Equals, "http://app1.tsuru.io/health")
+	}
+	commands := fexec.GetCommands("/bin/sh")
+	c.Assert(len(commands) > 1, check.Equals, true)
+	envs := commands[0].GetEnvs()
+	c.Assert(envs[len(envs)-3:len(envs)-1], check.DeepEquals, []string{"TSURU_APP=app2", "TSURU_APP_ADDRESS=app2.tsuru.io"})
+	envs = commands[1].GetEnvs()
+	c.Assert(envs[len(envs)-3:len(envs)-1], check.DeepEquals, []string{"TSURU_APP=app1", "TSURU_APP_ADDRESS=app1.tsuru.io"})
+}
+
+func (s *S) TestAppReleaseSwapsBack(c *check.C) {
+	_, restore := smokeServer(map[string]int{"app1.tsuru.io": 503, "app2.tsuru.io": 200})
+	defer restore()
+	api := newReleaseAPI()
+	out, err := runAppRelease(api, "--blue", "app1", "--green", "app2", "--source", "testdata", "--smoke-path", "/health")
+	c.Assert(err, check.ErrorMatches, `app "app1" failed the checks after the swap, the apps were swapped back: request to http://app1.tsuru.io/health failed with status 503`)
+	c.Assert(out, check.Matches, `(?s).*Check failed, swapping apps "app1" and "app2" back...
+`)
+	c.Assert(api.requests, check.DeepEquals, []string{
+		"POST /apps/app2/deploy",
+		"PUT /swap?app1=app1&app2=app2&force=false",
+		"PUT /swap?app1=app1&app2=app2&force=true",
+	})
+}
+
+func (s *S) TestAppReleaseCheckFailsBeforeSwap(c *check.C) {
+	_, restore := smokeServer(map[string]int{"app1.tsuru.io": 200, "app2.tsuru.io": 500})
+	defer restore()
+	api := newReleaseAPI()
+	_, err := runAppRelease(api, "--blue", "app1", "--green", "app2", "--source", "testdata", "--smoke-path", "/health")
+	c.Assert(err, check.ErrorMatches, `app "app2" failed the checks, the apps were not swapped: request to http://app2.tsuru.io/health failed with status 500`)
+	c.Assert(api.requests, check.DeepEquals, []string{"POST /apps/app2/deploy"})
+}
+
+func (s *S) TestAppReleaseDeployFailure(c *check.C) {
+	api := newReleaseAPI()
+	api.api.routes["POST /apps/app2/deploy"] = []string{"deploying\nbuild failed\n"}
+	_, err := runAppRelease(api, "--blue", "app1", "--green", "app2", "--source", "testdata")
+	c.Assert(err, check.ErrorMatches, `could not deploy to app "app2": the deploy failed`)
+	c.Assert(api.requests, check.DeepEquals, []string{"POST /apps/app2/deploy"})
+}
+
+func (s *S) TestAppReleaseSwapPreconditionFailed(c *check.C) {
+	api := newReleaseAPI()
+	api.api.routes["PUT /swap"] = []string{"Apps are not equal."}
+	api.statuses = map[string]int{"PUT /swap": http.StatusPreconditionFailed}
+	_, err := runAppRelease(api, "--blue", "app1", "--green", "app2", "--source", "testdata")
+	c.Assert(err, check.ErrorMatches, `could not swap the apps: Apps are not equal., use --force to swap anyway`)
+}
+
+func (s *S) TestAppReleaseIdleApp(c *check.C) {
+	blue := &app{Name: "app1"}
+	green := &app{Name: "app2"}
+	command := appRelease{}
+	_, _, err := command.releaseApps(blue, green)
+	c.Assert(err, check.ErrorMatches, `could not tell which app is idle, as neither or both "app1" and "app2" have cnames, please use --idle`)
+	command.idle = "app1"
+	live, idle, err := command.releaseApps(blue, green)
+	c.Assert(err, check.IsNil)
+	c.Assert(live, check.Equals, green)
+	c.Assert(idle, check.Equals, blue)
+	command.idle = "app3"
+	_, _, err = command.releaseApps(blue, green)
+	c.Assert(err, check.ErrorMatches, `the idle app must be either "app1" or "app2"`)
+	command.idle = ""
+	green.CName = []string{"www.example.com"}
+	live, idle, err = command.releaseApps(blue, green)
+	c.Assert(err, check.IsNil)
+	c.Assert(live, check.Equals, green)
+	c.Assert(idle, check.Equals, blue)
+}
+
+func (s *S) TestAppReleaseMissingFlags(c *check.C) {
+	_, err := runAppRelease(newReleaseAPI(), "--blue", "app1", "--source", "testdata")
+	c.Assert(err, check.ErrorMatches, "please provide the apps in --blue and --green, and the directory to deploy in --source")
+	_, err = runAppRelease(newReleaseAPI(), "--blue", "app1", "--green", "app1", "--source", "testdata")
+	c.Assert(err, check.ErrorMatches, "the blue and green apps must be different")
+}
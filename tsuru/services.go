@@ -20,14 +20,28 @@ import (
 	"launchpad.net/gnuflag"
 )
 
-type serviceList struct{}
+type serviceList struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (s *serviceList) Flags() *gnuflag.FlagSet {
+	if s.fs == nil {
+		s.fs = gnuflag.NewFlagSet("service-list", gnuflag.ExitOnError)
+		s.output.addFlags(s.fs)
+	}
+	return s.fs
+}
 
 func (s serviceList) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "service-list",
-		Usage: "service-list",
+		Usage: "service-list [--format table|json|yaml|template] [--template <template>]",
 		Desc: `Retrieves and shows a list of services the user has access. If the are
-instances created for any service they will also be shown.`,
+instances created for any service they will also be shown.
+
+The [[--format]] flag prints the services in the json, yaml or template
+formats, with the fields: service and instances.`,
 	}
 }
 
@@ -49,15 +63,31 @@ func (s serviceList) Run(ctx *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	rslt, err := cmd.ShowServicesInstancesList(b)
+	var services []serviceData
+	err = json.Unmarshal(b, &services)
 	if err != nil {
 		return err
 	}
-	n, err := ctx.Stdout.Write(rslt)
-	if n != len(rslt) {
-		return errors.New("Failed to write the output of the command")
+	for i := range services {
+		if services[i].Instances == nil {
+			services[i].Instances = []string{}
+		}
+		sort.Strings(services[i].Instances)
 	}
-	return nil
+	if services == nil {
+		services = []serviceData{}
+	}
+	return s.output.render(ctx.Stdout, services, func() error {
+		rslt, err := cmd.ShowServicesInstancesList(b)
+		if err != nil {
+			return err
+		}
+		n, err := ctx.Stdout.Write(rslt)
+		if n != len(rslt) {
+			return errors.New("Failed to write the output of the command")
+		}
+		return nil
+	})
 }
 
 type serviceAdd struct {
@@ -267,22 +297,50 @@ func (c serviceInstanceStatus) Run(ctx *cmd.Context, client *cmd.Client) error {
 	return nil
 }
 
-type serviceInfo struct{}
+type serviceInfo struct {
+	output outputFormat
+	fs     *gnuflag.FlagSet
+}
+
+func (c *serviceInfo) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("service-info", gnuflag.ExitOnError)
+		c.output.addFlags(c.fs)
+	}
+	return c.fs
+}
 
 func (c serviceInfo) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "service-info",
-		Usage: "service-info <service-name>",
+		Usage: "service-info <service-name> [--format table|json|yaml|template] [--template <template>]",
 		Desc: `Displays a list of all instances of a given service (that the user has access
-to), and apps bound to these instances.`,
+to), and apps bound to these instances.
+
+The [[--format]] flag prints the service in the json, yaml or template
+formats, with the fields: service, instances (name, apps and info) and plans
+(name and description).`,
 		MinArgs: 1,
 	}
 }
 
 type ServiceInstanceModel struct {
-	Name string
-	Apps []string
-	Info map[string]string
+	Name string            `json:"name" yaml:"name"`
+	Apps []string          `json:"apps" yaml:"apps"`
+	Info map[string]string `json:"info" yaml:"info"`
+}
+
+type servicePlan struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+// serviceInfoView is the representation of a service in the json, yaml and
+// template output formats.
+type serviceInfoView struct {
+	Service   string                 `json:"service" yaml:"service"`
+	Instances []ServiceInstanceModel `json:"instances" yaml:"instances"`
+	Plans     []servicePlan          `json:"plans" yaml:"plans"`
 }
 
 // in returns true if the list contains the value
@@ -308,29 +366,63 @@ func (serviceInfo) ExtraHeaders(instances []ServiceInstanceModel) []string {
 	return headers
 }
 
-func (c serviceInfo) BuildInstancesTable(serviceName string, ctx *cmd.Context, client *cmd.Client) error {
+func (c serviceInfo) fetchInstances(serviceName string, client *cmd.Client) ([]ServiceInstanceModel, error) {
 	url, err := cmd.GetURL("/services/" + serviceName)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	request, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	resp, err := client.Do(request)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer resp.Body.Close()
 	result, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	var instances []ServiceInstanceModel
 	err = json.Unmarshal(result, &instances)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return instances, nil
+}
+
+func (c serviceInfo) fetchPlans(serviceName string, client *cmd.Client) ([]servicePlan, error) {
+	url, err := cmd.GetURL(fmt.Sprintf("/services/%s/plans", serviceName))
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	result, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var plans []map[string]string
+	err = json.Unmarshal(result, &plans)
+	if err != nil {
+		return nil, err
+	}
+	servicePlans := make([]servicePlan, len(plans))
+	for i, plan := range plans {
+		servicePlans[i] = servicePlan{Name: plan["Name"], Description: plan["Description"]}
+	}
+	return servicePlans, nil
+}
+
+func (c serviceInfo) BuildInstancesTable(serviceName string, instances []ServiceInstanceModel, ctx *cmd.Context) {
 	ctx.Stdout.Write([]byte(fmt.Sprintf("Info for \"%s\"\n\n", serviceName)))
 	if len(instances) > 0 {
 		ctx.Stdout.Write([]byte("Instances\n"))
@@ -349,52 +441,39 @@ func (c serviceInfo) BuildInstancesTable(serviceName string, ctx *cmd.Context, c
 		table.Headers = cmd.Row(headers)
 		ctx.Stdout.Write(table.Bytes())
 	}
-	return nil
 }
 
-func (c serviceInfo) BuildPlansTable(serviceName string, ctx *cmd.Context, client *cmd.Client) error {
+func (c serviceInfo) BuildPlansTable(plans []servicePlan, ctx *cmd.Context) {
 	ctx.Stdout.Write([]byte("\nPlans\n"))
-	url, err := cmd.GetURL(fmt.Sprintf("/services/%s/plans", serviceName))
-	if err != nil {
-		return err
-	}
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return err
-	}
-	resp, err := client.Do(request)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-	result, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	var plans []map[string]string
-	err = json.Unmarshal(result, &plans)
-	if err != nil {
-		return err
-	}
 	if len(plans) > 0 {
 		table := cmd.NewTable()
 		for _, plan := range plans {
-			data := []string{plan["Name"], plan["Description"]}
-			table.AddRow(cmd.Row(data))
+			table.AddRow(cmd.Row([]string{plan.Name, plan.Description}))
 		}
 		table.Headers = cmd.Row([]string{"Name", "Description"})
 		ctx.Stdout.Write(table.Bytes())
 	}
-	return nil
 }
 
 func (c serviceInfo) Run(ctx *cmd.Context, client *cmd.Client) error {
 	serviceName := ctx.Args[0]
-	err := c.BuildInstancesTable(serviceName, ctx, client)
+	instances, err := c.fetchInstances(serviceName, client)
 	if err != nil {
 		return err
 	}
-	return c.BuildPlansTable(serviceName, ctx, client)
+	plans, err := c.fetchPlans(serviceName, client)
+	if err != nil {
+		return err
+	}
+	view := serviceInfoView{Service: serviceName, Instances: instances, Plans: plans}
+	if view.Instances == nil {
+		view.Instances = []ServiceInstanceModel{}
+	}
+	return c.output.render(ctx.Stdout, view, func() error {
+		c.BuildInstancesTable(serviceName, instances, ctx)
+		c.BuildPlansTable(plans, ctx)
+		return nil
+	})
 }
 
 type serviceDoc struct{}
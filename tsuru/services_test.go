@@ -496,3 +496,29 @@ func (s *S) TestServiceRemoveFlags(c *check.C) {
 	c.Check(sassume.DefValue, check.Equals, "false")
 	c.Check(command.yes, check.Equals, true)
 }
+
+func (s *S) TestServiceListFormatJSON(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	output := `[{"service": "mysql", "instances": ["mysql02", "mysql01"]}]`
+	ctx := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: output, Status: http.StatusOK}}, nil, manager)
+	command := serviceList{}
+	command.Flags().Parse(true, []string{"--format", "json"})
+	err := command.Run(&ctx, client)
+	c.Assert(err, check.IsNil)
+	expected := `[
+  {
+    "service": "mysql",
+    "instances": [
+      "mysql01",
+      "mysql02"
+    ]
+  }
+]
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
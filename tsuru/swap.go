@@ -7,6 +7,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/tsuru/tsuru/cmd"
@@ -17,18 +19,24 @@ import (
 type appSwap struct {
 	cmd.Command
 	force bool
+	check bool
 	fs    *gnuflag.FlagSet
 }
 
 func (s *appSwap) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-swap",
-		Usage: "app-swap <app1-name> <app2-name> [-f/--force]",
+		Usage: "app-swap <app1-name> <app2-name> [-f/--force] [--check]",
 		Desc: `Swaps routing between two apps. This allows zero downtime and makes rollback
 as simple as swapping the applications back.
 
 Use [[--force]] if you want to swap applications with a different numbers of
-units or diferent platform without confirmation.`,
+units or diferent platform without confirmation.
+
+Use [[--check]] to compare the apps side by side without swapping them. The
+platform, plan, units, cnames, environment variables and service instances of
+both apps are displayed, with the differences that make the swap risky
+highlighted and listed below the comparison.`,
 		MinArgs: 2,
 	}
 }
@@ -38,11 +46,15 @@ func (s *appSwap) Flags() *gnuflag.FlagSet {
 		s.fs = gnuflag.NewFlagSet("", gnuflag.ExitOnError)
 		s.fs.BoolVar(&s.force, "force", false, "Force Swap among apps with different number of units or different platform.")
 		s.fs.BoolVar(&s.force, "f", false, "Force Swap among apps with different number of units or different platform.")
+		s.fs.BoolVar(&s.check, "check", false, "Compare the apps without swapping them.")
 	}
 	return s.fs
 }
 
 func (s *appSwap) Run(context *cmd.Context, client *cmd.Client) error {
+	if s.check {
+		return s.preflight(context, client, context.Args[0], context.Args[1])
+	}
 	url, err := cmd.GetURL(fmt.Sprintf("/swap?app1=%s&app2=%s&force=%t", context.Args[0], context.Args[1], s.force))
 	if err != nil {
 		return err
@@ -74,3 +86,134 @@ func makeSwap(client *cmd.Client, url string) error {
 	_, err = client.Do(request)
 	return err
 }
+
+// preflight displays the comparison of the apps made by --check.
+func (s *appSwap) preflight(context *cmd.Context, client *cmd.Client, name1, name2 string) error {
+	app1, err := getLiveApp(client, name1)
+	if err != nil {
+		return err
+	}
+	if app1 == nil {
+		return fmt.Errorf("app %q not found", name1)
+	}
+	app2, err := getLiveApp(client, name2)
+	if err != nil {
+		return err
+	}
+	if app2 == nil {
+		return fmt.Errorf("app %q not found", name2)
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"", name1, name2})
+	var risks []string
+	addRow := func(label, value1, value2 string, risky bool) {
+		if risky {
+			value1, value2 = highlightLines(value1), highlightLines(value2)
+		}
+		table.AddRow(cmd.Row([]string{label, value1, value2}))
+	}
+	a1, a2 := app1.app, app2.app
+	platformRisk := a1.Platform != a2.Platform
+	if platformRisk {
+		risks = append(risks, fmt.Sprintf("the platforms are different (%s and %s)", a1.Platform, a2.Platform))
+	}
+	addRow("Platform", a1.Platform, a2.Platform, platformRisk)
+	planRisk := a1.Plan.Name != a2.Plan.Name
+	if planRisk {
+		risks = append(risks, fmt.Sprintf("the plans are different (%s and %s)", a1.Plan.Name, a2.Plan.Name))
+	}
+	addRow("Plan", a1.Plan.Name, a2.Plan.Name, planRisk)
+	unitsRisk := a1.unitCount() != a2.unitCount()
+	if unitsRisk {
+		risks = append(risks, fmt.Sprintf("the numbers of units are different (%d and %d)", a1.unitCount(), a2.unitCount()))
+	}
+	for _, a := range []*app{a1, a2} {
+		if !a.healthy() {
+			unitsRisk = true
+			risks = append(risks, fmt.Sprintf("app %q has units that are not available", a.Name))
+		}
+	}
+	addRow("Units", unitsSummary(a1), unitsSummary(a2), unitsRisk)
+	addRow("CNames", strings.Join(a1.CName, "\n"), strings.Join(a2.CName, "\n"), false)
+	names1, names2 := envNames(app1), envNames(app2)
+	only1, only2 := diffStrings(names2, names1)
+	envRisk := len(only1) > 0 || len(only2) > 0
+	if len(only1) > 0 {
+		risks = append(risks, fmt.Sprintf("environment variables only in app %q: %s", name1, strings.Join(only1, ", ")))
+	}
+	if len(only2) > 0 {
+		risks = append(risks, fmt.Sprintf("environment variables only in app %q: %s", name2, strings.Join(only2, ", ")))
+	}
+	addRow("Env vars", strings.Join(names1, "\n"), strings.Join(names2, "\n"), envRisk)
+	only1, only2 = diffStrings(app2.services, app1.services)
+	servicesRisk := len(only1) > 0 || len(only2) > 0
+	if len(only1) > 0 {
+		risks = append(risks, fmt.Sprintf("service instances only bound to app %q: %s", name1, strings.Join(only1, ", ")))
+	}
+	if len(only2) > 0 {
+		risks = append(risks, fmt.Sprintf("service instances only bound to app %q: %s", name2, strings.Join(only2, ", ")))
+	}
+	addRow("Services", strings.Join(app1.services, "\n"), strings.Join(app2.services, "\n"), servicesRisk)
+	table.LineSeparator = true
+	context.Stdout.Write(table.Bytes())
+	if len(risks) == 0 {
+		fmt.Fprintln(context.Stdout, "No differences that make the swap risky were found.")
+		return nil
+	}
+	fmt.Fprintln(context.Stdout, "Differences that make the swap risky:")
+	for _, risk := range risks {
+		fmt.Fprintf(context.Stdout, "  - %s\n", risk)
+	}
+	return nil
+}
+
+// highlightLines highlights each line of the value, so the highlight doesn't
+// spill over the borders of multi-line table cells.
+func highlightLines(value string) string {
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = cmd.Colorfy(line, "red", "", "bold")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// unitsSummary returns the number of units of the app, with the number of
+// units in each status.
+func unitsSummary(a *app) string {
+	counts := map[string]int{}
+	var statuses []string
+	for _, unit := range a.Units {
+		if unit.Name == "" {
+			continue
+		}
+		if counts[unit.Status] == 0 {
+			statuses = append(statuses, unit.Status)
+		}
+		counts[unit.Status]++
+	}
+	sort.Strings(statuses)
+	parts := make([]string, len(statuses))
+	for i, status := range statuses {
+		parts[i] = fmt.Sprintf("%d %s", counts[status], status)
+	}
+	summary := strconv.Itoa(a.unitCount())
+	if len(parts) > 0 {
+		summary += " (" + strings.Join(parts, ", ") + ")"
+	}
+	return summary
+}
+
+// envNames returns the sorted names of the environment variables of the app.
+func envNames(live *liveApp) []string {
+	var names []string
+	for name := range live.env {
+		names = append(names, name)
+	}
+	for name := range live.privateEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
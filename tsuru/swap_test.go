@@ -7,6 +7,7 @@ package main
 import (
 	"bytes"
 	"net/http"
+	"strings"
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/cmd/cmdtest"
@@ -77,3 +78,80 @@ func (s *S) TestSwapWhenAppsAreNotEqual(c *check.C) {
 func (s *S) TestSwapIsACommand(c *check.C) {
 	var _ cmd.Command = &appSwap{}
 }
+
+func swapCheckTransport(app2, env2, services2 string) http.RoundTripper {
+	api := &fakeAPI{routes: map[string][]string{
+		"GET /apps/app1":     {`{"name":"app1","platform":"python","plan":{"name":"small"},"cname":["www.example.com"],"units":[{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"started"}]}`},
+		"GET /apps/app1/env": {`[{"name":"DEBUG","value":"false","public":true},{"name":"SECRET","value":"","public":false}]`},
+		"GET /apps/app2":     {app2},
+		"GET /apps/app2/env": {env2},
+	}}
+	return transportFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path == "/services/instances" {
+			api.routes["GET /services/instances"] = []string{`[{"service":"mysql","instances":["mysql1"]}]`}
+			if req.URL.Query().Get("app") == "app2" {
+				api.routes["GET /services/instances"] = []string{services2}
+			}
+		}
+		return api.RoundTrip(req)
+	})
+}
+
+func runSwapCheck(transport http.RoundTripper) (string, error) {
+	var buf bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"app1", "app2"},
+		Stdout: &buf,
+	}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appSwap{}
+	command.Flags().Parse(true, []string{"--check"})
+	err := command.Run(&context, client)
+	return buf.String(), err
+}
+
+func (s *S) TestSwapCheck(c *check.C) {
+	transport := swapCheckTransport(
+		`{"name":"app2","platform":"python","plan":{"name":"small"},"units":[{"Name":"app2/0","Status":"started"},{"Name":"app2/1","Status":"started"}]}`,
+		`[{"name":"DEBUG","value":"true","public":true},{"name":"SECRET","value":"","public":false}]`,
+		`[{"service":"mysql","instances":["mysql1"]}]`,
+	)
+	out, err := runSwapCheck(transport)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(out, "| Units    | 2 (2 started)   | 2 (2 started) |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| CNames   | www.example.com |               |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| Env vars | DEBUG           | DEBUG         |\n|          | SECRET          | SECRET        |"), check.Equals, true)
+	c.Assert(strings.HasSuffix(out, "No differences that make the swap risky were found.\n"), check.Equals, true)
+}
+
+func (s *S) TestSwapCheckRisky(c *check.C) {
+	transport := swapCheckTransport(
+		`{"name":"app2","platform":"go","plan":{"name":"small"},"units":[{"Name":"app2/0","Status":"error"}]}`,
+		`[{"name":"DEBUG","value":"true","public":true},{"name":"WORKERS","value":"4","public":true}]`,
+		`[]`,
+	)
+	out, err := runSwapCheck(transport)
+	c.Assert(err, check.IsNil)
+	red := func(value string) string {
+		return cmd.Colorfy(value, "red", "", "bold")
+	}
+	c.Assert(strings.Contains(out, "| Platform | "+red("python")+"          | "+red("go")+"          |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| Plan     | small           | small       |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| Units    | "+red("2 (2 started)")+"   | "+red("1 (1 error)")+" |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| Env vars | "+red("DEBUG")+"           | "+red("DEBUG")+"       |\n|          | "+red("SECRET")+"          | "+red("WORKERS")+"     |"), check.Equals, true)
+	c.Assert(strings.Contains(out, "| Services | "+red("mysql1")+"          |             |"), check.Equals, true)
+	c.Assert(strings.HasSuffix(out, `Differences that make the swap risky:
+  - the platforms are different (python and go)
+  - the numbers of units are different (2 and 1)
+  - app "app2" has units that are not available
+  - environment variables only in app "app1": SECRET
+  - environment variables only in app "app2": WORKERS
+  - service instances only bound to app "app1": mysql1
+`), check.Equals, true)
+}
+
+func (s *S) TestSwapCheckAppNotFound(c *check.C) {
+	transport := swapCheckTransport("404 App app2 not found.", "", "")
+	_, err := runSwapCheck(transport)
+	c.Assert(err, check.ErrorMatches, `app "app2" not found`)
+}
@@ -0,0 +1,18 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// isTerminal reports whether the given reader or writer is a terminal. It's
+// a variable so tests can simulate interactive sessions.
+var isTerminal = func(f interface{}) bool {
+	file, ok := f.(*os.File)
+	return ok && terminal.IsTerminal(int(file.Fd()))
+}
@@ -0,0 +1,168 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+)
+
+const defaultWatchInterval = 2 * time.Second
+
+// watchFlag is the value of the --watch flag. It may be used alone, refreshing
+// the output every two seconds, or with an interval, as in --watch=10s.
+type watchFlag struct {
+	enabled  bool
+	interval time.Duration
+}
+
+func (f *watchFlag) String() string {
+	if !f.enabled {
+		return ""
+	}
+	return f.interval.String()
+}
+
+func (f *watchFlag) Set(value string) error {
+	switch value {
+	case "true":
+		f.enabled, f.interval = true, defaultWatchInterval
+		return nil
+	case "false":
+		f.enabled = false
+		return nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(value)
+		if convErr != nil {
+			return fmt.Errorf("invalid watch interval %q", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+	if interval <= 0 {
+		return errors.New("the watch interval must be positive")
+	}
+	f.enabled, f.interval = true, interval
+	return nil
+}
+
+func (f *watchFlag) IsBoolFlag() bool {
+	return true
+}
+
+// watchInterrupt returns the channel notified when the user asks the watch
+// to stop, and the function that stops the notifications. It's a variable so
+// tests can interrupt the watch.
+var watchInterrupt = func() (<-chan os.Signal, func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	return c, func() { signal.Stop(c) }
+}
+
+// watchSnapshot is the state of the watched apps in one refresh.
+type watchSnapshot struct {
+	// statuses holds the status of each unit, by unit name.
+	statuses map[string]string
+	// render returns the output of the command, highlighting the units
+	// whose status changed since the previous refresh.
+	render func(changed map[string]bool) string
+}
+
+type statusChange struct {
+	unit string
+	from string
+	to   string
+}
+
+func (c statusChange) String() string {
+	switch {
+	case c.from == "":
+		return fmt.Sprintf("%s: %s", c.unit, c.to)
+	case c.to == "":
+		return fmt.Sprintf("%s: removed (was %s)", c.unit, c.from)
+	}
+	return fmt.Sprintf("%s: %s -> %s", c.unit, c.from, c.to)
+}
+
+func diffStatuses(previous, current map[string]string) []statusChange {
+	var changes []statusChange
+	for unit, status := range current {
+		if old, ok := previous[unit]; !ok || old != status {
+			changes = append(changes, statusChange{unit: unit, from: old, to: status})
+		}
+	}
+	for unit, status := range previous {
+		if _, ok := current[unit]; !ok {
+			changes = append(changes, statusChange{unit: unit, from: status})
+		}
+	}
+	sort.Sort(statusChangesByUnit(changes))
+	return changes
+}
+
+type statusChangesByUnit []statusChange
+
+func (l statusChangesByUnit) Len() int           { return len(l) }
+func (l statusChangesByUnit) Less(i, j int) bool { return l[i].unit < l[j].unit }
+func (l statusChangesByUnit) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+
+// watch calls refresh in the given interval until the user interrupts it.
+//
+// On terminals, the output is redrawn in place after each refresh, with
+// the units whose status changed highlighted. Otherwise, only the status
+// changes are printed, one per line, prefixed by the time of the refresh.
+// Failed refreshes are reported without stopping the watch.
+func watch(context *cmd.Context, title string, interval time.Duration, refresh func() (*watchSnapshot, error)) error {
+	interrupt, stop := watchInterrupt()
+	defer stop()
+	tty := isTerminal(context.Stdout)
+	var previous map[string]string
+	for {
+		now := time.Now().Format("2006-01-02 15:04:05")
+		snapshot, err := refresh()
+		switch {
+		case err != nil && tty:
+			fmt.Fprint(context.Stdout, "\033[H\033[2J")
+			fmt.Fprintf(context.Stdout, "Every %s: %s    %s\n\n", interval, title, now)
+			fmt.Fprintf(context.Stdout, "Error: %s\n", cmd.Colorfy(err.Error(), "red", "", ""))
+		case err != nil:
+			fmt.Fprintf(context.Stdout, "%s error: %s\n", now, err)
+		case tty:
+			changed := map[string]bool{}
+			if previous != nil {
+				for _, change := range diffStatuses(previous, snapshot.statuses) {
+					changed[change.unit] = true
+				}
+			}
+			fmt.Fprint(context.Stdout, "\033[H\033[2J")
+			fmt.Fprintf(context.Stdout, "Every %s: %s    %s\n\n", interval, title, now)
+			fmt.Fprint(context.Stdout, strings.TrimRight(snapshot.render(changed), "\n")+"\n")
+		default:
+			for _, change := range diffStatuses(previous, snapshot.statuses) {
+				fmt.Fprintf(context.Stdout, "%s %s\n", now, change)
+			}
+		}
+		if err == nil {
+			previous = snapshot.statuses
+		}
+		select {
+		case <-interrupt:
+			if tty {
+				fmt.Fprintln(context.Stdout)
+			}
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
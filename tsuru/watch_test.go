@@ -0,0 +1,224 @@
+// Copyright 2015 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+)
+
+var watchTimestamp = regexp.MustCompile(`(?m)^\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2} `)
+
+// fakeWatchInterrupt replaces watchInterrupt with a channel controlled by the
+// test, returning the channel and a function that restores the original.
+func fakeWatchInterrupt() (chan os.Signal, func()) {
+	old := watchInterrupt
+	interrupt := make(chan os.Signal, 1)
+	watchInterrupt = func() (<-chan os.Signal, func()) {
+		return interrupt, func() {}
+	}
+	return interrupt, func() { watchInterrupt = old }
+}
+
+// watchAppTransport serves the app1 app with the units given for each
+// refresh, interrupting the watch after the last one.
+func watchAppTransport(interrupt chan os.Signal, refreshes []string) http.RoundTripper {
+	var calls int
+	return transportFunc(func(req *http.Request) (*http.Response, error) {
+		body, status := "", http.StatusOK
+		if req.URL.Path == "/apps/app1" {
+			units := refreshes[calls]
+			calls++
+			if calls == len(refreshes) {
+				interrupt <- os.Interrupt
+			}
+			if units == "" {
+				status = http.StatusInternalServerError
+				body = "something went wrong"
+			} else {
+				body = `{"name":"app1","platform":"php","ip":"app1.tsuru.io","units":[` + units + `]}`
+			}
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			StatusCode: status,
+		}, nil
+	})
+}
+
+func (s *S) TestWatchFlag(c *check.C) {
+	var tests = []struct {
+		args     []string
+		enabled  bool
+		interval time.Duration
+	}{
+		{nil, false, 0},
+		{[]string{"--watch"}, true, defaultWatchInterval},
+		{[]string{"--watch=10s"}, true, 10 * time.Second},
+		{[]string{"--watch=5"}, true, 5 * time.Second},
+		{[]string{"--watch=500ms"}, true, 500 * time.Millisecond},
+	}
+	for _, t := range tests {
+		var f watchFlag
+		fs := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+		fs.Var(&f, "watch", "")
+		err := fs.Parse(true, t.args)
+		c.Check(err, check.IsNil)
+		c.Check(f.enabled, check.Equals, t.enabled)
+		c.Check(f.interval, check.Equals, t.interval)
+	}
+}
+
+func (s *S) TestWatchFlagInvalid(c *check.C) {
+	var f watchFlag
+	c.Assert(f.Set("soon"), check.ErrorMatches, `invalid watch interval "soon"`)
+	c.Assert(f.Set("0"), check.ErrorMatches, "the watch interval must be positive")
+	c.Assert(f.Set("-1s"), check.ErrorMatches, "the watch interval must be positive")
+	c.Assert(f.enabled, check.Equals, false)
+}
+
+func (s *S) TestDiffStatuses(c *check.C) {
+	previous := map[string]string{"app1/0": "started", "app1/1": "pending", "app1/2": "started"}
+	current := map[string]string{"app1/0": "started", "app1/1": "started", "app1/3": "building"}
+	changes := diffStatuses(previous, current)
+	c.Assert(changes, check.DeepEquals, []statusChange{
+		{unit: "app1/1", from: "pending", to: "started"},
+		{unit: "app1/2", from: "started"},
+		{unit: "app1/3", to: "building"},
+	})
+	c.Assert(changes[0].String(), check.Equals, "app1/1: pending -> started")
+	c.Assert(changes[1].String(), check.Equals, "app1/2: removed (was started)")
+	c.Assert(changes[2].String(), check.Equals, "app1/3: building")
+}
+
+func (s *S) TestAppInfoWatchNotTerminal(c *check.C) {
+	interrupt, restore := fakeWatchInterrupt()
+	defer restore()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	transport := watchAppTransport(interrupt, []string{
+		`{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"pending"}`,
+		`{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"pending"}`,
+		"",
+		`{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"started"}`,
+		`{"Name":"app1/0","Status":"started"}`,
+	})
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"-a", "app1", "--watch=10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(watchTimestamp.FindAllString(stdout.String(), -1), check.HasLen, 5)
+	expected := `app1/0: started
+app1/1: pending
+error: something went wrong
+app1/1: pending -> started
+app1/1: removed (was started)
+`
+	c.Assert(watchTimestamp.ReplaceAllString(stdout.String(), ""), check.Equals, expected)
+}
+
+func (s *S) TestAppInfoWatchTerminal(c *check.C) {
+	oldIsTerminal := isTerminal
+	isTerminal = func(interface{}) bool { return true }
+	defer func() {
+		isTerminal = oldIsTerminal
+	}()
+	interrupt, restore := fakeWatchInterrupt()
+	defer restore()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	transport := watchAppTransport(interrupt, []string{
+		`{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"pending"}`,
+		`{"Name":"app1/0","Status":"started"},{"Name":"app1/1","Status":"started"}`,
+	})
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"-a", "app1", "--watch=10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	frames := strings.Split(stdout.String(), "\033[H\033[2J")
+	c.Assert(frames, check.HasLen, 3)
+	c.Assert(frames[0], check.Equals, "")
+	highlighted := cmd.Colorfy("started", "yellow", "", "bold")
+	c.Assert(frames[1], check.Matches, `(?s)Every 10ms: tsuru app-info -a app1 .*\| app1/1 \| pending \|.*`)
+	c.Assert(strings.Contains(frames[1], highlighted), check.Equals, false)
+	c.Assert(strings.Contains(frames[2], "| app1/0 | started |"), check.Equals, true)
+	c.Assert(strings.Contains(frames[2], "| app1/1 | "+highlighted+" |"), check.Equals, true)
+}
+
+func (s *S) TestAppInfoWatchWithFormat(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	command := appInfo{}
+	command.Flags().Parse(true, []string{"-a", "app1", "--watch", "--format", "json"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "--watch can't be used with --format or --template")
+}
+
+func (s *S) TestAppListWatchNotTerminal(c *check.C) {
+	interrupt, restore := fakeWatchInterrupt()
+	defer restore()
+	refreshes := []string{
+		`[{"name":"app1","units":[{"Name":"app1/0","Status":"started"}]},{"name":"app2","units":[{"Name":"app2/0","Status":"building"}]}]`,
+		`[{"name":"app1","units":[{"Name":"app1/0","Status":"error"}]},{"name":"app2","units":[{"Name":"app2/0","Status":"started"}]}]`,
+	}
+	var calls int
+	transport := transportFunc(func(req *http.Request) (*http.Response, error) {
+		body := refreshes[calls]
+		calls++
+		if calls == len(refreshes) {
+			interrupt <- os.Interrupt
+		}
+		return &http.Response{
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			StatusCode: http.StatusOK,
+		}, nil
+	})
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{Transport: transport}, nil, manager)
+	command := appList{}
+	command.Flags().Parse(true, []string{"--watch=10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `app1/0: started
+app2/0: building
+app1/0: started -> error
+app2/0: building -> started
+`
+	c.Assert(watchTimestamp.ReplaceAllString(stdout.String(), ""), check.Equals, expected)
+}
+
+func (s *S) TestAppListWatchTerminalHighlightsChangedApps(c *check.C) {
+	apps := []app{
+		{Name: "app1", Units: []unit{{Name: "app1/0", Status: "started"}}},
+		{Name: "app2", Units: []unit{{Name: "app2/0", Status: "started"}}},
+	}
+	table := appList{}.table(apps, map[string]bool{"app2/0": true}).String()
+	highlighted := cmd.Colorfy("1 of 1 units in-service", "yellow", "", "bold")
+	c.Assert(strings.Contains(table, "| app1        | 1 of 1 units in-service |"), check.Equals, true)
+	c.Assert(strings.Contains(table, "| app2        | "+highlighted+" |"), check.Equals, true)
+}
+
+func (s *S) TestAppListWatchWithQuiet(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	command := appList{}
+	command.Flags().Parse(true, []string{"--watch", "-q"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "--watch can't be used with --quiet, --format or --template")
+}